@@ -0,0 +1,71 @@
+package crawlbot
+
+import (
+	"net/http"
+)
+
+// The number of consecutive successful requests to a host before its concurrency limit is raised
+const adaptiveRampAfter = 5
+
+// Adaptive concurrency state for a host
+type hostConcurrency struct {
+	limit     int // Maximum number of concurrent requests
+	inflight  int // Number of requests currently running
+	successes int // Consecutive successful requests since the limit last changed
+}
+
+// Get the adaptive concurrency state for a host. Must be called with the mutex held.
+func (c *Crawler) hostConcurrency(host string) *hostConcurrency {
+	if c.adaptive == nil {
+		c.adaptive = make(map[string]*hostConcurrency)
+	}
+	hc, ok := c.adaptive[host]
+	if !ok {
+		hc = &hostConcurrency{limit: 1}
+		c.adaptive[host] = hc
+	}
+	return hc
+}
+
+// Check if a host has capacity for another request. Must be called with the mutex held.
+func (c *Crawler) adaptiveAllow(host string) bool {
+	hc := c.hostConcurrency(host)
+	return hc.inflight < hc.limit
+}
+
+// Record the start of a request. Must be called with the mutex held.
+func (c *Crawler) adaptiveStart(url string) {
+	c.hostConcurrency(hostOf(url)).inflight++
+}
+
+// Record the end of a dispatch that didn't make a request, leaving the host's limit as it is.
+// Must be called with the mutex held.
+func (c *Crawler) adaptiveRelease(url string) {
+	c.hostConcurrency(hostOf(url)).inflight--
+}
+
+// Record the end of a request and adjust the host's limit. Must be called with the mutex held.
+func (c *Crawler) adaptiveFinish(res result) {
+	hc := c.hostConcurrency(hostOf(res.url))
+	hc.inflight--
+
+	status := 0
+	if res.resp.Response != nil {
+		status = res.resp.StatusCode
+	}
+	failed := status == 0 || status == http.StatusTooManyRequests || status >= 500
+	if failed {
+		hc.limit /= 2
+		if hc.limit < 1 {
+			hc.limit = 1
+		}
+		hc.successes = 0
+		return
+	}
+
+	hc.successes++
+	if hc.successes >= adaptiveRampAfter && hc.limit < c.NumWorkers {
+		hc.limit++
+		hc.successes = 0
+	}
+}
@@ -0,0 +1,78 @@
+package crawlbot
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A RoundTripper for a server that is overloaded by more than capacity concurrent requests, responding with 503
+type overloadedTransport struct {
+	pages    map[string]MockResponse
+	capacity int
+
+	mux      sync.Mutex
+	inflight int
+	peak     int
+	rejected int
+	total    int
+}
+
+func (t *overloadedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mux.Lock()
+	t.inflight++
+	t.total++
+	if t.inflight > t.peak {
+		t.peak = t.inflight
+	}
+	overloaded := t.inflight > t.capacity
+	if overloaded {
+		t.rejected++
+	}
+	t.mux.Unlock()
+	defer func() {
+		t.mux.Lock()
+		t.inflight--
+		t.mux.Unlock()
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	if overloaded {
+		return (&mockTransport{responses: map[string]MockResponse{req.URL.String(): {StatusCode: http.StatusServiceUnavailable}}}).RoundTrip(req)
+	}
+	return (&mockTransport{responses: t.pages}).RoundTrip(req)
+}
+
+func TestAdaptiveConcurrency(t *testing.T) {
+	var body strings.Builder
+	pages := map[string]MockResponse{}
+	for i := 0; i < 60; i++ {
+		page := "/" + strconv.Itoa(i)
+		body.WriteString(`<a href="` + page + `">x</a>`)
+		pages["http://example.com"+page] = MockResponse{}
+	}
+	pages["http://example.com/"] = MockResponse{Body: body.String()}
+
+	transport := &overloadedTransport{pages: pages, capacity: 2}
+	c := &Crawler{
+		URLs:                []string{"http://example.com/"},
+		NumWorkers:          8,
+		AdaptiveConcurrency: true,
+		Handler:             func(resp *Response) {},
+		Client:              func() *http.Client { return &http.Client{Transport: transport} },
+	}
+	crawl(t, c)
+
+	if transport.peak < 2 {
+		t.Errorf("Expected concurrency to ramp up beyond 1, peaked at %d", transport.peak)
+	}
+	if transport.peak > 3 {
+		t.Errorf("Expected concurrency to back off once the host was overloaded, peaked at %d", transport.peak)
+	}
+	if rate := float64(transport.rejected) / float64(transport.total); rate > 0.25 {
+		t.Errorf("Expected few requests to overload the host, %d of %d did", transport.rejected, transport.total)
+	}
+}
@@ -0,0 +1,42 @@
+package crawlbot
+
+import (
+	"time"
+)
+
+// Limits on the size of a crawl. Zero values mean no limit.
+// The crawler stops when any one of the limits is reached; ongoing jobs are allowed to finish as with Stop().
+type Budget struct {
+	// The maximum number of URLs to process
+	MaxPages int
+
+	// The maximum total number of response body bytes to read
+	MaxBytes int64
+
+	// The maximum amount of time to crawl for, measured from Start()
+	MaxDuration time.Duration
+}
+
+// Get the reason the crawler stopped, if it was stopped because it reached a limit in its Budget.
+// Returns ErrBudgetPages, ErrBudgetBytes or ErrBudgetDuration, or nil if no budget limit has been reached.
+func (c *Crawler) StopReason() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.reason
+}
+
+// Stop the crawler if it has exceeded its page or byte budget. Must be called with the mutex held.
+func (c *Crawler) checkBudget() {
+	if c.Budget.MaxPages > 0 && c.stats.Requests >= c.Budget.MaxPages {
+		c.stopBudget(ErrBudgetPages)
+	} else if c.Budget.MaxBytes > 0 && c.stats.Bytes >= c.Budget.MaxBytes {
+		c.stopBudget(ErrBudgetBytes)
+	}
+}
+
+// Stop the crawler because a budget limit was reached. Must be called with the mutex held.
+func (c *Crawler) stopBudget(reason error) {
+	c.reason = reason
+	c.stop()
+}
@@ -0,0 +1,34 @@
+package crawlbot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBudget(t *testing.T) {
+	tests := []struct {
+		budget Budget
+		reason error
+	}{
+		{Budget{MaxPages: 2}, ErrBudgetPages},
+		{Budget{MaxBytes: 1}, ErrBudgetBytes},
+		{Budget{MaxDuration: 30 * time.Millisecond}, ErrBudgetDuration},
+		{Budget{MaxPages: 100}, nil},
+	}
+	for _, test := range tests {
+		transport := newTestTransport(testSite)
+		transport.delay = 20 * time.Millisecond
+		c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 1, Budget: test.budget, Handler: func(resp *Response) {}, Client: transport.client}
+		crawl(t, c)
+
+		if reason := c.StopReason(); reason != test.reason {
+			t.Errorf("%+v: expected stop reason %v, got %v", test.budget, test.reason, reason)
+		}
+		if test.reason == nil && transport.total() != len(testSite) {
+			t.Errorf("%+v: expected the whole site to be crawled, got %d requests", test.budget, transport.total())
+		}
+		if test.reason != nil && transport.total() >= len(testSite) {
+			t.Errorf("%+v: expected the crawl to stop early, got %d requests", test.budget, transport.total())
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package crawlbot
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Matches a charset declared in a <meta charset> or <meta http-equiv="Content-Type"> tag
+var metaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_\-:.]+)`)
+
+// Byte order marks and the charsets they identify
+var boms = []struct {
+	bom     []byte
+	charset string
+}{
+	{[]byte{0xEF, 0xBB, 0xBF}, "utf-8"},
+	{[]byte{0xFE, 0xFF}, "utf-16be"},
+	{[]byte{0xFF, 0xFE}, "utf-16le"},
+}
+
+// Common aliases for charset names
+var charsetAliases = map[string]string{
+	"utf8":       "utf-8",
+	"ascii":      "us-ascii",
+	"latin1":     "iso-8859-1",
+	"iso8859-1":  "iso-8859-1",
+	"iso_8859-1": "iso-8859-1",
+}
+
+// Resolve the charset of a body. Following the HTML spec, a byte order mark takes precedence over the Content-Type
+// header, which takes precedence over a <meta> tag in the first 1024 bytes.
+// If these sources declare different charsets, warning describes the conflict.
+// Returns an empty charset if none is declared.
+func resolveCharset(header http.Header, body []byte) (charset string, warning string) {
+	var fromBOM, fromHeader, fromMeta string
+
+	for _, b := range boms {
+		if bytes.HasPrefix(body, b.bom) {
+			fromBOM = b.charset
+			break
+		}
+	}
+
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil {
+		fromHeader = normalizeCharset(params["charset"])
+	}
+
+	prescan := body
+	if len(prescan) > 1024 {
+		prescan = prescan[:1024]
+	}
+	if match := metaCharset.FindSubmatch(prescan); match != nil {
+		fromMeta = normalizeCharset(string(match[1]))
+	}
+
+	// Report any sources that disagree with the one we use
+	sources := []struct{ name, charset string }{{"byte order mark", fromBOM}, {"Content-Type header", fromHeader}, {"meta tag", fromMeta}}
+	for _, source := range sources {
+		if source.charset == "" {
+			continue
+		}
+		if charset == "" {
+			charset = source.charset
+		} else if source.charset != charset {
+			warning = "Charset " + charset + " conflicts with " + source.charset + " declared by the " + source.name
+			break
+		}
+	}
+
+	return charset, warning
+}
+
+// Normalize a charset name to lower case and its canonical name
+func normalizeCharset(charset string) string {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if canonical, ok := charsetAliases[charset]; ok {
+		return canonical
+	}
+	return charset
+}
+
+// Check that a body is valid in the given charset, returning a description of the problem if it isn't.
+// Only UTF-8 and US-ASCII can be validated. Bodies in other charsets are assumed to be valid.
+func validateCharset(charset string, body []byte) string {
+	switch charset {
+	case "utf-8":
+		if !utf8.Valid(body) {
+			return "Body is not valid UTF-8"
+		}
+	case "us-ascii":
+		for _, b := range body {
+			if b >= 0x80 {
+				return "Body is not valid US-ASCII"
+			}
+		}
+	}
+	return ""
+}
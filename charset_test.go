@@ -0,0 +1,71 @@
+package crawlbot
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResolveCharset(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		charset     string
+		conflict    bool
+	}{
+		{"text/html", "<p>no charset</p>", "", false},
+		{"text/html; charset=UTF8", "<p>header</p>", "utf-8", false},
+		{"text/html", `<meta charset="latin1">`, "iso-8859-1", false},
+		{"text/html", `<meta http-equiv="Content-Type" content="text/html; charset=us-ascii">`, "us-ascii", false},
+		{"text/html; charset=utf-8", `<meta charset="utf-8">`, "utf-8", false},
+		{"text/html; charset=iso-8859-1", `<meta charset="utf-8">`, "iso-8859-1", true},
+		{"text/html; charset=iso-8859-1", "\xEF\xBB\xBF<p>bom</p>", "utf-8", true},
+		{"text/html", "\xFF\xFE<\x00p\x00>\x00", "utf-16le", false},
+	}
+	for _, test := range tests {
+		charset, warning := resolveCharset(http.Header{"Content-Type": {test.contentType}}, []byte(test.body))
+		if charset != test.charset || (warning != "") != test.conflict {
+			t.Errorf("%q %q: expected %q with conflict %v, got %q %q", test.contentType, test.body, test.charset, test.conflict, charset, warning)
+		}
+	}
+}
+
+func TestValidateCharset(t *testing.T) {
+	tests := []struct {
+		charset string
+		body    string
+		valid   bool
+	}{
+		{"utf-8", "caf\xC3\xA9", true},
+		{"utf-8", "caf\xE9", false},
+		{"us-ascii", "cafe", true},
+		{"us-ascii", "caf\xC3\xA9", false},
+		{"iso-8859-1", "caf\xE9", true},
+		{"", "caf\xE9", true},
+	}
+	for _, test := range tests {
+		if issue := validateCharset(test.charset, []byte(test.body)); (issue == "") != test.valid {
+			t.Errorf("%s %q: expected valid %v, got %q", test.charset, test.body, test.valid, issue)
+		}
+	}
+}
+
+func TestValidateEncoding(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/":         {Body: `<a href="/bad">bad</a><a href="/conflict">conflict</a>`},
+		"http://example.com/bad":      {Body: "caf\xE9"},
+		"http://example.com/conflict": {Header: http.Header{"Content-Type": {"text/html; charset=us-ascii"}}, Body: `<meta charset="utf-8">`},
+	}
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 1, ValidateEncoding: true, Handler: rec.handle, Client: NewMockClient(pages)}
+	crawl(t, c)
+
+	if resp := rec.get("http://example.com/"); resp.EncodingIssue != "" || resp.EncodingWarning != "" {
+		t.Errorf("Expected no encoding problems on a valid page, got %q %q", resp.EncodingIssue, resp.EncodingWarning)
+	}
+	if resp := rec.get("http://example.com/bad"); resp.EncodingIssue == "" {
+		t.Error("Expected invalid UTF-8 to be reported")
+	}
+	if resp := rec.get("http://example.com/conflict"); resp.EncodingWarning == "" || resp.EncodingIssue != "" {
+		t.Errorf("Expected a conflicting meta tag to be warned about, got %q %q", resp.EncodingIssue, resp.EncodingWarning)
+	}
+}
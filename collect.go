@@ -0,0 +1,47 @@
+package crawlbot
+
+import (
+	"sync"
+)
+
+// Crawl the given URLs and collect every Response into a slice, returning once the crawl is finished.
+// checkURL decides which discovered links are followed. If it is nil links are followed if they are in one
+// of the same domains as the seed URLs.
+// Every Response, including its body, is held in memory, so Collect is only suitable for modest crawls.
+// Returns ErrNoWorkers if numWorkers isn't positive and ErrNoURLs if urls is empty.
+func Collect(urls []string, numWorkers int, checkURL func(crawler *Crawler, url string) bool) ([]*Response, error) {
+	if numWorkers <= 0 {
+		return nil, ErrNoWorkers
+	}
+	if len(urls) == 0 {
+		return nil, ErrNoURLs
+	}
+
+	var mux sync.Mutex
+	responses := make([]*Response, 0)
+
+	crawler := &Crawler{
+		URLs:       urls,
+		NumWorkers: numWorkers,
+		Handler: func(resp *Response) {
+			mux.Lock()
+			responses = append(responses, resp)
+			mux.Unlock()
+		},
+	}
+	if checkURL != nil {
+		crawler.CheckURL = func(crawler *Crawler, url string) error {
+			if checkURL(crawler, url) {
+				return nil
+			}
+			return ErrURLRejected
+		}
+	}
+
+	if err := crawler.Start(); err != nil {
+		return nil, err
+	}
+	crawler.Wait()
+
+	return responses, nil
+}
@@ -0,0 +1,53 @@
+package crawlbot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCollect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/a">a</a><a href="/skip">skip</a>`))
+		case "/a":
+			w.Write([]byte(`<a href="/b">b</a>`))
+		default:
+			w.Write([]byte("leaf"))
+		}
+	}))
+	defer server.Close()
+
+	responses, err := Collect([]string{server.URL + "/"}, 2, func(crawler *Crawler, url string) bool {
+		return !strings.HasSuffix(url, "/skip")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := make([]string, 0, len(responses))
+	for _, resp := range responses {
+		urls = append(urls, strings.TrimPrefix(resp.URL, server.URL))
+	}
+	sort.Strings(urls)
+	if strings.Join(urls, " ") != "/ /a /b" {
+		t.Errorf("Expected / /a /b to be collected, got %v", urls)
+	}
+	for _, resp := range responses {
+		if resp.URL == server.URL+"/b" && string(resp.bytes) != "leaf" {
+			t.Errorf("Expected collected responses to keep their bodies, got %q", resp.bytes)
+		}
+	}
+}
+
+func TestCollectInvalid(t *testing.T) {
+	if _, err := Collect([]string{"http://example.com/"}, 0, nil); err != ErrNoWorkers {
+		t.Errorf("Expected ErrNoWorkers, got %v", err)
+	}
+	if _, err := Collect(nil, 2, nil); err != ErrNoURLs {
+		t.Errorf("Expected ErrNoURLs, got %v", err)
+	}
+}
@@ -0,0 +1,1077 @@
+package crawlbot
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A small site on example.com. The root page also links to a page on another host.
+var testSite = map[string]MockResponse{
+	"http://example.com/":  {Body: `<a href="/a">a</a><a href="/b">b</a><a href="http://other.com/">other</a>`},
+	"http://example.com/a": {Body: `<a href="/">home</a><a href="/c">c</a>`},
+	"http://example.com/b": {Body: `<a href="/c">c</a>`},
+	"http://example.com/c": {Body: `done`},
+}
+
+// Records the responses passed to a Handler
+type recorder struct {
+	mux       sync.Mutex
+	responses map[string]*Response
+	order     []string
+}
+
+func newRecorder() *recorder {
+	return &recorder{responses: make(map[string]*Response)}
+}
+
+func (r *recorder) handle(resp *Response) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.responses[resp.URL] = resp
+	r.order = append(r.order, resp.URL)
+}
+
+func (r *recorder) get(url string) *Response {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return r.responses[url]
+}
+
+// Get the handled URLs in the order they were dispatched
+func (r *recorder) bySeq() []string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	urls := make([]string, 0, len(r.responses))
+	for url := range r.responses {
+		urls = append(urls, url)
+	}
+	sort.Slice(urls, func(i, j int) bool {
+		return r.responses[urls[i]].Seq < r.responses[urls[j]].Seq
+	})
+	return urls
+}
+
+// A RoundTripper that serves canned responses like NewMockClient, counting requests and optionally delaying them
+type testTransport struct {
+	pages  map[string]MockResponse
+	delay  time.Duration            // Delay before every response
+	delays map[string]time.Duration // Delays for specific URLs, overriding delay
+	hang   map[string]bool          // URLs whose requests never complete until they are cancelled
+	start  chan bool                // If set, receives a value whenever a request starts, without blocking
+
+	mux      sync.Mutex
+	requests map[string]int
+	headers  map[string]http.Header
+	times    []time.Time
+	inflight int
+	peak     int
+}
+
+func newTestTransport(pages map[string]MockResponse) *testTransport {
+	return &testTransport{
+		pages:    pages,
+		delays:   make(map[string]time.Duration),
+		hang:     make(map[string]bool),
+		requests: make(map[string]int),
+		headers:  make(map[string]http.Header),
+	}
+}
+
+func (t *testTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+	t.mux.Lock()
+	t.requests[url]++
+	t.headers[url] = req.Header.Clone()
+	t.times = append(t.times, time.Now())
+	t.inflight++
+	if t.inflight > t.peak {
+		t.peak = t.inflight
+	}
+	delay, ok := t.delays[url]
+	if !ok {
+		delay = t.delay
+	}
+	hang := t.hang[url]
+	t.mux.Unlock()
+	defer func() {
+		t.mux.Lock()
+		t.inflight--
+		t.mux.Unlock()
+	}()
+
+	if t.start != nil {
+		select {
+		case t.start <- true:
+		default:
+		}
+	}
+	if hang {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	return (&mockTransport{responses: t.pages}).RoundTrip(req)
+}
+
+func (t *testTransport) client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+func (t *testTransport) count(url string) int {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	return t.requests[url]
+}
+
+func (t *testTransport) total() int {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	total := 0
+	for _, n := range t.requests {
+		total += n
+	}
+	return total
+}
+
+// Start a crawler and wait for it to finish
+func crawl(t testing.TB, c *Crawler) {
+	t.Helper()
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, c)
+}
+
+// Wait for a crawler to finish, failing the test if it takes too long
+func waitFor(t testing.TB, c *Crawler) {
+	t.Helper()
+	done := make(chan bool)
+	go func() {
+		c.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Crawl did not finish")
+	}
+}
+
+// Wait for a URL to reach a state, failing the test if it takes too long
+func waitForState(t testing.TB, c *Crawler, url string, state State) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.State(url) != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s did not reach state %v", url, state)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// A page whose Handler blocks in tests until they release it, keeping a crawl running while URLs are added to it
+const holdURL = "http://example.com/hold"
+
+// Copy pages and add holdURL
+func withHold(pages map[string]MockResponse) map[string]MockResponse {
+	held := map[string]MockResponse{holdURL: {}}
+	for url, page := range pages {
+		held[url] = page
+	}
+	return held
+}
+
+// Check if an error is, or wraps, target
+func isErr(err, target error) bool {
+	return err != nil && strings.Contains(err.Error(), target.Error())
+}
+
+func TestCrawl(t *testing.T) {
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 2, Handler: rec.handle, Client: NewMockClient(testSite)}
+	crawl(t, c)
+
+	for url := range testSite {
+		if resp := rec.get(url); resp == nil || resp.Err != nil {
+			t.Errorf("%s was not crawled successfully: %v", url, resp)
+		}
+		if state := c.State(url); state != StateDone {
+			t.Errorf("%s is in state %v, expected StateDone", url, state)
+		}
+	}
+	if state := c.State("http://other.com/"); state != StateNotFound {
+		t.Errorf("Link outside the seed domains is in state %v, expected StateNotFound", state)
+	}
+}
+
+func TestLinkCounts(t *testing.T) {
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 1, Handler: rec.handle, Client: NewMockClient(testSite)}
+	crawl(t, c)
+
+	resp := rec.get("http://example.com/")
+	if resp.LinksFound != 3 || resp.LinksFollowed != 2 {
+		t.Errorf("Expected 3 links found and 2 followed, got %d and %d", resp.LinksFound, resp.LinksFollowed)
+	}
+	if resp := rec.get("http://example.com/c"); resp.LinksFound != 0 || resp.LinksFollowed != 0 {
+		t.Errorf("Expected no links on a page without any, got %d and %d", resp.LinksFound, resp.LinksFollowed)
+	}
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	pages := map[string]MockResponse{"http://example.com/": {}}
+	var body strings.Builder
+	for _, c := range "abcdefghijklmnopqrst" {
+		body.WriteString(`<a href="/` + string(c) + `">x</a>`)
+		pages["http://example.com/"+string(c)] = MockResponse{}
+	}
+	pages["http://example.com/"] = MockResponse{Body: body.String()}
+
+	transport := newTestTransport(pages)
+	transport.delay = 10 * time.Millisecond
+	c := &Crawler{
+		URLs:                  []string{"http://example.com/"},
+		NumWorkers:            8,
+		MaxConcurrentRequests: 2,
+		Handler:               func(resp *Response) {},
+		Client:                transport.client,
+	}
+	crawl(t, c)
+
+	if transport.total() != len(pages) {
+		t.Errorf("Expected %d requests, got %d", len(pages), transport.total())
+	}
+	if transport.peak > 2 {
+		t.Errorf("%d requests were in flight at once, expected at most 2", transport.peak)
+	}
+}
+
+func TestMaxConcurrentRequestsRejected(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/":     {Body: `<a href="/missing">missing</a><a href="/loop">loop</a>`},
+		"http://example.com/loop": {StatusCode: http.StatusMovedPermanently, Header: http.Header{"Location": {"http://example.com/loop#top"}}},
+		"http://example.com/a":    {},
+		"http://example.com/b":    {},
+	}
+	next := map[string]string{"http://example.com/missing": "http://example.com/a", "http://example.com/loop": "http://example.com/b"}
+	fetched := map[string]chan bool{"http://example.com/a": make(chan bool), "http://example.com/b": make(chan bool)}
+	c := &Crawler{
+		URLs:                  []string{"http://example.com/"},
+		NumWorkers:            3,
+		MaxConcurrentRequests: 1,
+		Client:                NewMockClient(pages),
+	}
+	c.Handler = func(resp *Response) {
+		if done, ok := fetched[resp.URL]; ok {
+			close(done)
+		}
+		// Another URL can only be fetched while the Handler runs if the request slot was released before it was called
+		if url, ok := next[resp.URL]; ok {
+			c.Add(url)
+			select {
+			case <-fetched[url]:
+			case <-time.After(5 * time.Second):
+				t.Errorf("Expected the request slot to be released before the Handler for %s", resp.URL)
+			}
+		}
+	}
+	crawl(t, c)
+}
+
+func TestSequenceNumbers(t *testing.T) {
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 3, Handler: rec.handle, Client: NewMockClient(testSite)}
+	crawl(t, c)
+
+	for i, url := range rec.bySeq() {
+		if seq := rec.get(url).Seq; seq != i+1 {
+			t.Errorf("Expected sequence numbers 1 to %d without gaps, %s has %d", len(testSite), url, seq)
+		}
+	}
+}
+
+func TestWorkerIDs(t *testing.T) {
+	pages := map[string]MockResponse{}
+	var body strings.Builder
+	for _, c := range "abcdefghij" {
+		body.WriteString(`<a href="/` + string(c) + `">x</a>`)
+		pages["http://example.com/"+string(c)] = MockResponse{}
+	}
+	pages["http://example.com/"] = MockResponse{Body: body.String()}
+
+	var mux sync.Mutex
+	busy := make(map[int]bool)
+	seen := make(map[int]bool)
+	c := &Crawler{
+		URLs:       []string{"http://example.com/"},
+		NumWorkers: 4,
+		Client:     NewMockClient(pages),
+		Handler: func(resp *Response) {
+			mux.Lock()
+			if busy[resp.WorkerID] {
+				t.Errorf("Worker %d is handling two URLs at once", resp.WorkerID)
+			}
+			busy[resp.WorkerID] = true
+			seen[resp.WorkerID] = true
+			mux.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mux.Lock()
+			busy[resp.WorkerID] = false
+			mux.Unlock()
+		},
+	}
+	crawl(t, c)
+
+	for id := range seen {
+		if id < 0 || id >= 4 {
+			t.Errorf("Worker ID %d is out of range", id)
+		}
+	}
+	if len(seen) < 2 {
+		t.Errorf("Expected several workers to be used, saw %d", len(seen))
+	}
+}
+
+func TestSeedsBeforeDiscovered(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/":   {Body: `<a href="/d1">1</a><a href="/d2">2</a><a href="/d3">3</a>`},
+		"http://example.com/d1": {},
+		"http://example.com/d2": {},
+		"http://example.com/d3": {},
+		"http://example.com/s2": {},
+	}
+	rec := newRecorder()
+	c := &Crawler{
+		URLs:       []string{"http://example.com/"},
+		NumWorkers: 1,
+		Client:     NewMockClient(pages),
+		Handler: func(resp *Response) {
+			if resp.URL == "http://example.com/d1" {
+				resp.Crawler.Add("http://example.com/s2")
+			}
+			rec.handle(resp)
+		},
+	}
+	crawl(t, c)
+
+	expected := []string{"http://example.com/", "http://example.com/d1", "http://example.com/s2", "http://example.com/d2", "http://example.com/d3"}
+	if order := rec.bySeq(); strings.Join(order, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected the added seed to be crawled before older discovered URLs, got %v", order)
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/a": {Body: `<a href="/b">b</a><a href="/c">c</a>`},
+		"http://example.com/b": {Body: `<a href="/d">d</a>`},
+		"http://example.com/c": {Body: `<a href="/e">e</a>`},
+		"http://example.com/d": {},
+		"http://example.com/e": {},
+	}
+	tests := []struct {
+		order    QueueOrder
+		expected string
+	}{
+		{QueueFIFO, "a b c d e"},
+		{QueueLIFO, "a c e b d"},
+	}
+	for _, test := range tests {
+		rec := newRecorder()
+		c := &Crawler{URLs: []string{"http://example.com/a"}, NumWorkers: 1, QueueOrder: test.order, Handler: rec.handle, Client: NewMockClient(pages)}
+		crawl(t, c)
+
+		order := rec.bySeq()
+		for i := range order {
+			order[i] = strings.TrimPrefix(order[i], "http://example.com/")
+		}
+		if strings.Join(order, " ") != test.expected {
+			t.Errorf("Queue order %d: expected %s, got %v", test.order, test.expected, order)
+		}
+	}
+}
+
+func TestDiscoverOnly(t *testing.T) {
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 2, DiscoverOnly: true, Client: NewMockClient(testSite)}
+	crawl(t, c)
+
+	urls := c.AllURLs()
+	sort.Strings(urls)
+	expected := []string{"http://example.com/", "http://example.com/a", "http://example.com/b", "http://example.com/c"}
+	if strings.Join(urls, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected %v to be discovered, got %v", expected, urls)
+	}
+}
+
+func TestRequeue(t *testing.T) {
+	transport := newTestTransport(testSite)
+	var mux sync.Mutex
+	requeued := false
+	c := &Crawler{
+		URLs:       []string{"http://example.com/"},
+		NumWorkers: 2,
+		Client:     transport.client,
+		Handler: func(resp *Response) {
+			mux.Lock()
+			defer mux.Unlock()
+			if resp.URL == "http://example.com/a" && !requeued {
+				requeued = true
+				if err := resp.Crawler.Requeue(resp.URL); err != nil {
+					t.Error(err)
+				}
+			}
+		},
+	}
+	crawl(t, c)
+
+	if n := transport.count("http://example.com/a"); n != 2 {
+		t.Errorf("Expected the requeued URL to be fetched twice, got %d", n)
+	}
+	if n := transport.count("http://example.com/b"); n != 1 {
+		t.Errorf("Expected other URLs to be fetched once, got %d", n)
+	}
+}
+
+func TestMaxRetries(t *testing.T) {
+	transport := newTestTransport(testSite)
+	c := &Crawler{
+		URLs:       []string{"http://example.com/c"},
+		NumWorkers: 1,
+		MaxRetries: 2,
+		Client:     transport.client,
+		Handler: func(resp *Response) {
+			resp.Crawler.Requeue(resp.URL)
+		},
+	}
+	crawl(t, c)
+
+	if n := transport.count("http://example.com/c"); n != 3 {
+		t.Errorf("Expected a URL requeued every time to be fetched 1 + MaxRetries times, got %d", n)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	transport := newTestTransport(testSite)
+	transport.hang["http://example.com/"] = true
+	transport.start = make(chan bool, 1)
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 1, DrainTimeout: 50 * time.Millisecond, Handler: rec.handle, Client: transport.client}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-transport.start
+
+	start := time.Now()
+	c.Stop()
+	waitFor(t, c)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Expected Wait to return shortly after DrainTimeout, took %s", elapsed)
+	}
+	if resp := rec.get("http://example.com/"); resp == nil || resp.Err != context.Canceled {
+		t.Errorf("Expected the hanging request to be cancelled, got %v", resp)
+	}
+	if state := c.State("http://example.com/"); state != StatePending {
+		t.Errorf("Expected the cancelled URL to be left pending, got %v", state)
+	}
+}
+
+func TestStartContext(t *testing.T) {
+	transport := newTestTransport(testSite)
+	transport.hang["http://example.com/"] = true
+	transport.start = make(chan bool, 1)
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 1, Handler: rec.handle, Client: transport.client}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := c.StartContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	<-transport.start
+
+	cancel()
+	waitFor(t, c)
+	if resp := rec.get("http://example.com/"); resp == nil || resp.Err != context.Canceled {
+		t.Errorf("Expected the request to be aborted with context.Canceled, got %v", resp)
+	}
+	if state := c.State("http://example.com/"); state != StatePending {
+		t.Errorf("Expected the aborted URL to be left pending, got %v", state)
+	}
+	if c.IsRunning() {
+		t.Error("Expected the crawler to have stopped")
+	}
+}
+
+func TestPersistent(t *testing.T) {
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 2, Persistent: true, Handler: rec.handle, Client: NewMockClient(testSite)}
+	crawl(t, c)
+
+	// A Persistent crawler finishes like any other once it runs out of URLs
+	if c.IsRunning() {
+		t.Error("Expected a Persistent crawler to stop once it has run out of URLs")
+	}
+	for url := range testSite {
+		if rec.get(url) == nil {
+			t.Errorf("Expected %s to be crawled", url)
+		}
+	}
+}
+
+func TestRecrawl(t *testing.T) {
+	transport := newTestTransport(withHold(testSite))
+	handled := make(chan string, 10)
+	release := make(chan bool)
+	c := &Crawler{
+		URLs:       []string{"http://example.com/c", holdURL},
+		NumWorkers: 2,
+		Client:     transport.client,
+		Handler: func(resp *Response) {
+			if resp.URL == holdURL {
+				<-release
+				return
+			}
+			handled <- resp.URL
+		},
+	}
+	if err := c.Recrawl("http://example.com/c"); err != ErrURLNotFound {
+		t.Errorf("Expected ErrURLNotFound for an unknown URL, got %v", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-handled
+	waitForState(t, c, "http://example.com/c", StateDone)
+
+	if err := c.Recrawl("http://example.com/c"); err != nil {
+		t.Fatal(err)
+	}
+	<-handled
+	close(release)
+	waitFor(t, c)
+
+	if n := transport.count("http://example.com/c"); n != 2 {
+		t.Errorf("Expected the recrawled URL to be fetched twice, got %d", n)
+	}
+}
+
+func TestOnStateChange(t *testing.T) {
+	var mux sync.Mutex
+	transitions := make([]string, 0)
+	names := map[State]string{StateNotFound: "notfound", StatePending: "pending", StateRunning: "running", StateDone: "done", StateRejected: "rejected"}
+	c := &Crawler{
+		URLs:       []string{"http://example.com/c"},
+		NumWorkers: 1,
+		Client:     NewMockClient(testSite),
+		Handler:    func(resp *Response) {},
+		OnStateChange: func(url string, from, to State) {
+			mux.Lock()
+			defer mux.Unlock()
+			transitions = append(transitions, names[from]+">"+names[to])
+		},
+	}
+	crawl(t, c)
+
+	// State changes are delivered on their own goroutine, so they may still be arriving
+	expected := "notfound>pending pending>running running>done"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mux.Lock()
+		got := strings.Join(transitions, " ")
+		mux.Unlock()
+		if got == expected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected transitions %q, got %q", expected, got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWaitForURL(t *testing.T) {
+	transport := newTestTransport(withHold(testSite))
+	transport.delay = 20 * time.Millisecond
+	release := make(chan bool)
+	c := &Crawler{
+		URLs:       []string{holdURL},
+		NumWorkers: 4,
+		Client:     transport.client,
+		Handler: func(resp *Response) {
+			if resp.URL == holdURL {
+				<-release
+			}
+		},
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Add("http://example.com/b")
+			if state := c.WaitForURL("http://example.com/b"); state != StateDone {
+				t.Errorf("Expected WaitForURL to return StateDone, got %v", state)
+			}
+		}()
+	}
+	wg.Wait()
+	close(release)
+	waitFor(t, c)
+
+	if n := transport.count("http://example.com/b"); n != 1 {
+		t.Errorf("Expected a URL added concurrently to be fetched once, got %d", n)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/0": {Body: `<a href="/1">1</a>`},
+		"http://example.com/1": {Body: `<a href="/2">2</a>`},
+		"http://example.com/2": {Body: `<a href="/3">3</a>`},
+		"http://example.com/3": {},
+	}
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/0"}, NumWorkers: 1, MaxDepth: 2, Handler: rec.handle, Client: NewMockClient(pages)}
+	crawl(t, c)
+
+	if resp := rec.get("http://example.com/2"); resp == nil || resp.Depth != 2 {
+		t.Errorf("Expected the page at MaxDepth to be crawled at depth 2, got %v", resp)
+	}
+	if state := c.State("http://example.com/3"); state != StateRejected {
+		t.Errorf("Expected the page beyond MaxDepth to be rejected, got %v", state)
+	}
+	if depth := c.Depth("http://example.com/3"); depth != 3 {
+		t.Errorf("Expected Depth to report 3, got %d", depth)
+	}
+	if depth := c.Depth("http://example.com/unknown"); depth != -1 {
+		t.Errorf("Expected Depth of an unknown URL to be -1, got %d", depth)
+	}
+}
+
+func TestDedupKey(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/":          {Body: `<a href="/p?token=1">1</a><a href="/p?token=2">2</a><a href="/p?token=3">3</a>`},
+		"http://example.com/p?token=1": {},
+	}
+	transport := newTestTransport(pages)
+	c := &Crawler{
+		URLs:       []string{"http://example.com/"},
+		NumWorkers: 2,
+		Handler:    func(resp *Response) {},
+		Client:     transport.client,
+		DedupKey: func(url string) string {
+			return strings.Split(url, "?")[0]
+		},
+	}
+	crawl(t, c)
+
+	if n := transport.total(); n != 2 {
+		t.Errorf("Expected URLs differing only by token to be fetched once, got %d requests", n)
+	}
+	if state := c.State("http://example.com/p?token=3"); state != StateDone {
+		t.Errorf("Expected any URL with the same key to report the key's state, got %v", state)
+	}
+}
+
+func TestMarkDone(t *testing.T) {
+	transport := newTestTransport(testSite)
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 2, Handler: func(resp *Response) {}, Client: transport.client}
+	c.MarkDone([]string{"http://example.com/b"})
+	crawl(t, c)
+
+	if n := transport.count("http://example.com/b"); n != 0 {
+		t.Errorf("Expected a URL marked done not to be fetched, got %d requests", n)
+	}
+	if state := c.State("http://example.com/b"); state != StateDone {
+		t.Errorf("Expected a URL marked done to be in StateDone, got %v", state)
+	}
+	if n := transport.count("http://example.com/c"); n != 1 {
+		t.Errorf("Expected other URLs to be crawled, got %d requests", n)
+	}
+}
+
+func TestMarkDonePending(t *testing.T) {
+	c := &Crawler{
+		URLs:       []string{"http://example.com/c", "http://example.com/b"},
+		NumWorkers: 1,
+		CrawlDelay: time.Hour,
+		Handler:    func(resp *Response) {},
+		Client:     NewMockClient(testSite),
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waited := c.frontier().wait("http://example.com/b")
+
+	// The second seed waits out the crawl delay until it is marked done, which finishes the crawl
+	waitForState(t, c, "http://example.com/c", StateDone)
+	c.MarkDone([]string{"http://example.com/b"})
+	select {
+	case state := <-waited:
+		if state != StateDone {
+			t.Errorf("Expected WaitForURL to return StateDone, got %v", state)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected WaitForURL to return once the URL was marked done")
+	}
+	waitFor(t, c)
+}
+
+func TestSetURLTimeout(t *testing.T) {
+	pages := map[string]MockResponse{"http://example.com/fast": {}, "http://example.com/slow": {}}
+	transport := newTestTransport(pages)
+	transport.delay = 100 * time.Millisecond
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/fast", "http://example.com/slow"}, NumWorkers: 2, Handler: rec.handle, Client: transport.client}
+	c.SetURLTimeout("http://example.com/fast", 10*time.Millisecond)
+	c.SetURLTimeout("http://example.com/slow", 5*time.Second)
+	crawl(t, c)
+
+	if resp := rec.get("http://example.com/fast"); resp == nil || !isErr(resp.Err, ErrReqFailed) {
+		t.Errorf("Expected the URL with a short timeout to fail, got %v", resp)
+	}
+	if resp := rec.get("http://example.com/slow"); resp == nil || resp.Err != nil {
+		t.Errorf("Expected the URL with a long timeout to succeed, got %v", resp)
+	}
+}
+
+func TestMaxHosts(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/": {Body: `<a href="http://h1.com/">1</a><a href="http://h2.com/">2</a><a href="http://h3.com/">3</a><a href="http://h4.com/">4</a>`},
+	}
+	for _, host := range []string{"h1", "h2", "h3", "h4"} {
+		pages["http://"+host+".com/"] = MockResponse{}
+	}
+	c := &Crawler{
+		URLs:       []string{"http://example.com/"},
+		NumWorkers: 2,
+		MaxHosts:   3,
+		Handler:    func(resp *Response) {},
+		CheckURL:   func(crawler *Crawler, url string) error { return nil },
+		Client:     NewMockClient(pages),
+	}
+	crawl(t, c)
+
+	done, rejected := 0, 0
+	for _, host := range []string{"h1", "h2", "h3", "h4"} {
+		switch c.State("http://" + host + ".com/") {
+		case StateDone:
+			done++
+		case StateRejected:
+			rejected++
+		}
+	}
+	if done != 2 || rejected != 2 {
+		t.Errorf("Expected 2 more hosts to be crawled and 2 rejected, got %d and %d", done, rejected)
+	}
+}
+
+func TestSlowHandler(t *testing.T) {
+	var mux sync.Mutex
+	slow := make([]string, 0)
+	c := &Crawler{
+		URLs:                 []string{"http://example.com/"},
+		NumWorkers:           2,
+		Client:               NewMockClient(testSite),
+		SlowHandlerThreshold: 20 * time.Millisecond,
+		Handler: func(resp *Response) {
+			if resp.URL == "http://example.com/a" {
+				time.Sleep(40 * time.Millisecond)
+			}
+		},
+		SlowHandler: func(crawler *Crawler, url string, elapsed time.Duration) {
+			mux.Lock()
+			defer mux.Unlock()
+			slow = append(slow, url)
+			if elapsed < 20*time.Millisecond {
+				t.Errorf("SlowHandler called with an elapsed time of %s", elapsed)
+			}
+		},
+	}
+	crawl(t, c)
+
+	if len(slow) != 1 || slow[0] != "http://example.com/a" {
+		t.Errorf("Expected only the slow Handler to be reported, got %v", slow)
+	}
+}
+
+func TestStreamingLinkFinder(t *testing.T) {
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 2, Handler: rec.handle, Client: NewMockClient(testSite)}
+	c.StreamingLinkFinder = func(resp *Response, found func(url string)) {
+		for _, link := range defaultLinkFinder(resp) {
+			found(link)
+			if hostOf(link) == "example.com" && c.State(link) == StateNotFound {
+				t.Errorf("Expected %s to be queued as soon as it was found", link)
+			}
+		}
+	}
+	crawl(t, c)
+
+	for url := range testSite {
+		if rec.get(url) == nil {
+			t.Errorf("Expected %s to be crawled", url)
+		}
+	}
+	if resp := rec.get("http://example.com/"); resp.LinksFound != 3 || resp.LinksFollowed != 2 {
+		t.Errorf("Expected 3 links found and 2 followed, got %d and %d", resp.LinksFound, resp.LinksFollowed)
+	}
+}
+
+func TestPanickingHooks(t *testing.T) {
+	rec := newRecorder()
+	c := &Crawler{
+		URLs:       []string{"http://example.com/"},
+		NumWorkers: 2,
+		Handler:    rec.handle,
+		Client:     NewMockClient(testSite),
+		LinkFinder: func(resp *Response) []string {
+			if resp.URL == "http://example.com/a" {
+				panic("broken page")
+			}
+			return defaultLinkFinder(resp)
+		},
+		CheckURL: func(crawler *Crawler, url string) error {
+			if url == "http://other.com/" {
+				panic("broken check")
+			}
+			return defaultCheckURL(crawler, url)
+		},
+	}
+	crawl(t, c)
+
+	if resp := rec.get("http://example.com/a"); resp == nil || !isErr(resp.Err, ErrLinkFinderPanic) {
+		t.Errorf("Expected a panicking LinkFinder to be reported, got %v", resp)
+	}
+	if resp := rec.get("http://example.com/"); resp == nil || !isErr(resp.Err, ErrCheckURLPanic) {
+		t.Errorf("Expected a panicking CheckURL to be reported, got %v", resp)
+	}
+	if rec.get("http://example.com/c") == nil {
+		t.Error("Expected the crawl to continue past the panics")
+	}
+}
+
+func TestStreamingLinkFinderPanic(t *testing.T) {
+	rec := newRecorder()
+	c := &Crawler{
+		URLs:       []string{"http://example.com/"},
+		NumWorkers: 1,
+		Handler:    rec.handle,
+		Client:     NewMockClient(testSite),
+		StreamingLinkFinder: func(resp *Response, found func(url string)) {
+			if resp.URL == "http://example.com/" {
+				found("http://example.com/a")
+				panic("broken page")
+			}
+		},
+	}
+	crawl(t, c)
+
+	resp := rec.get("http://example.com/")
+	if resp == nil || !isErr(resp.Err, ErrLinkFinderPanic) {
+		t.Fatalf("Expected a panicking StreamingLinkFinder to be reported, got %v", resp)
+	}
+	if resp.LinksFound != 1 || resp.LinksFollowed != 1 {
+		t.Errorf("Expected the link found before the panic to be counted, got %d found and %d followed", resp.LinksFound, resp.LinksFollowed)
+	}
+	if rec.get("http://example.com/a") == nil {
+		t.Error("Expected the link found before the panic to be crawled")
+	}
+}
+
+func TestAcceptHeader(t *testing.T) {
+	transport := newTestTransport(testSite)
+	c := &Crawler{
+		URLs:       []string{"http://example.com/c"},
+		NumWorkers: 1,
+		Handler:    func(resp *Response) {},
+		Client:     transport.client,
+		UserAgent:  "testbot/1.0",
+		Accept:     "text/html",
+		Header:     http.Header{"X-Test": {"yes"}, "Accept": {"overridden"}},
+	}
+	crawl(t, c)
+
+	sent := transport.headers["http://example.com/c"]
+	for name, value := range map[string]string{"User-Agent": "testbot/1.0", "Accept": "text/html", "X-Test": "yes"} {
+		if got := sent.Get(name); got != value {
+			t.Errorf("Expected %s %q to be sent, got %q", name, value, got)
+		}
+	}
+}
+
+func TestResponseRequest(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/old": {StatusCode: http.StatusMovedPermanently, Header: http.Header{"Location": {"http://example.com/new"}}},
+		"http://example.com/new": {},
+	}
+	rec := newRecorder()
+	c := &Crawler{
+		URLs:       []string{"http://example.com/old"},
+		NumWorkers: 1,
+		Handler:    rec.handle,
+		Client:     NewMockClient(pages),
+		UserAgent:  "testbot/1.0",
+		Header:     http.Header{"X-Test": {"yes"}},
+	}
+	crawl(t, c)
+
+	resp := rec.get("http://example.com/old")
+	if resp == nil || resp.Request == nil {
+		t.Fatal("Expected the request to be captured")
+	}
+	if got := resp.Request.URL.String(); got != "http://example.com/new" {
+		t.Errorf("Expected the request for the final URL, got %s", got)
+	}
+	for name, value := range map[string]string{"User-Agent": "testbot/1.0", "X-Test": "yes"} {
+		if got := resp.Request.Header.Get(name); got != value {
+			t.Errorf("Expected the captured request to have %s %q, got %q", name, value, got)
+		}
+	}
+}
+
+func TestResponseDoc(t *testing.T) {
+	var title, body string
+	c := &Crawler{
+		URLs:       []string{"http://example.com/"},
+		NumWorkers: 1,
+		Client:     NewMockClient(map[string]MockResponse{"http://example.com/": {Body: `<title>Home</title>`}}),
+		Handler: func(resp *Response) {
+			if resp.Doc != nil {
+				title = resp.Doc.Find("title").Text()
+			}
+			raw := make([]byte, 100)
+			n, _ := resp.Body.Read(raw)
+			body = string(raw[:n])
+		},
+	}
+	crawl(t, c)
+
+	if title != "Home" {
+		t.Errorf("Expected the Handler to be passed the parsed document, got title %q", title)
+	}
+	if body != `<title>Home</title>` {
+		t.Errorf("Expected the Handler to still be able to read the body, got %q", body)
+	}
+}
+
+func TestDuplicateTitles(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/":  {Body: `<title> Home </title><a href="/a">a</a><a href="/b">b</a><a href="/c">c</a>`},
+		"http://example.com/a": {Body: `<title>Products</title>`},
+		"http://example.com/b": {Body: `<title>Products</title>`},
+		"http://example.com/c": {Body: `<title>Home</title>`},
+	}
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 2, TrackTitles: true, Handler: func(resp *Response) {}, Client: NewMockClient(pages)}
+	crawl(t, c)
+
+	duplicates := c.DuplicateTitles()
+	if len(duplicates) != 2 {
+		t.Fatalf("Expected 2 duplicated titles, got %v", duplicates)
+	}
+	for title, expected := range map[string]string{"Home": "http://example.com/ http://example.com/c", "Products": "http://example.com/a http://example.com/b"} {
+		urls := duplicates[title]
+		sort.Strings(urls)
+		if strings.Join(urls, " ") != expected {
+			t.Errorf("Expected %q to be shared by %s, got %v", title, expected, urls)
+		}
+	}
+}
+
+// Benchmark the number of connections opened with and without HostAffinity. Each worker has its own client, so a
+// worker that stays on one host can reuse its connection instead of dialing each host in turn.
+func BenchmarkHostAffinity(b *testing.B) {
+	for _, affinity := range []bool{false, true} {
+		name := "default"
+		if affinity {
+			name = "affinity"
+		}
+		b.Run(name, func(b *testing.B) {
+			var mux sync.Mutex
+			conns := 0
+			servers := make([]string, 0, 4)
+			for i := 0; i < 4; i++ {
+				server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "text/html")
+					w.Write([]byte("page"))
+				}))
+				server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+					if state == http.StateNew {
+						mux.Lock()
+						conns++
+						mux.Unlock()
+					}
+				}
+				server.Start()
+				defer server.Close()
+				servers = append(servers, server.URL)
+			}
+
+			// Interleave the hosts, so that without affinity each worker moves from host to host
+			urls := make([]string, 0)
+			for page := 0; page < 25; page++ {
+				for _, server := range servers {
+					urls = append(urls, server+"/"+strconv.Itoa(page))
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c := &Crawler{
+					URLs:         urls,
+					NumWorkers:   4,
+					HostAffinity: affinity,
+					Handler:      func(resp *Response) {},
+					Client: func() *http.Client {
+						return &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 1}}
+					},
+				}
+				crawl(b, c)
+			}
+			b.ReportMetric(float64(conns)/float64(b.N), "conns/op")
+		})
+	}
+}
+
+// Benchmark a crawl with far more pending URLs than workers, so that dispatch is bound by the scheduler rather than
+// by fetching
+func BenchmarkDispatch(b *testing.B) {
+	var body strings.Builder
+	pages := map[string]MockResponse{}
+	for i := 0; i < 2000; i++ {
+		page := "/" + strconv.Itoa(i)
+		body.WriteString(`<a href="` + page + `">x</a>`)
+		pages["http://example.com"+page] = MockResponse{}
+	}
+	pages["http://example.com/"] = MockResponse{Body: body.String()}
+
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 64, Handler: func(resp *Response) {}, Client: NewMockClient(pages)}
+		crawl(b, c)
+	}
+	b.ReportMetric(float64(len(pages)*b.N)/time.Since(start).Seconds(), "pages/s")
+}
@@ -0,0 +1,74 @@
+/*
+Package crawlprom exports crawlbot statistics as Prometheus metrics.
+
+	crawler := crawlbot.NewCrawler("http://example.com", myURLHandler, 4)
+	prometheus.MustRegister(crawlprom.NewCollector(crawler))
+	crawler.Start()
+
+The prometheus dependency is isolated to this package so that crawlbot itself doesn't require it.
+*/
+package crawlprom
+
+import (
+	"strings"
+
+	"github.com/phayes/crawlbot"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The kinds of error reported, so that every kind has a series even before it occurs
+var errKinds = []crawlbot.ErrKind{
+	crawlbot.ErrKindDNS,
+	crawlbot.ErrKindTimeout,
+	crawlbot.ErrKindConnection,
+	crawlbot.ErrKindTooManyRequests,
+	crawlbot.ErrKindServer,
+	crawlbot.ErrKindOther,
+}
+
+// Collector is a prometheus.Collector that reports the Stats of a Crawler
+type Collector struct {
+	crawler  *crawlbot.Crawler
+	requests *prometheus.Desc
+	errors   *prometheus.Desc
+	bytes    *prometheus.Desc
+	inflight *prometheus.Desc
+	urls     *prometheus.Desc
+}
+
+// Create a new Collector for a crawler. Register it with your own prometheus registry.
+func NewCollector(crawler *crawlbot.Crawler) *Collector {
+	return &Collector{
+		crawler:  crawler,
+		requests: prometheus.NewDesc("crawlbot_requests_total", "Total number of URLs processed.", nil, nil),
+		errors:   prometheus.NewDesc("crawlbot_errors_total", "Total number of URLs that resulted in an error, by kind of error.", []string{"kind"}, nil),
+		bytes:    prometheus.NewDesc("crawlbot_bytes_total", "Total number of response body bytes read.", nil, nil),
+		inflight: prometheus.NewDesc("crawlbot_in_flight", "Number of URLs currently being processed.", nil, nil),
+		urls:     prometheus.NewDesc("crawlbot_urls", "Number of URLs in each state.", []string{"state"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.requests
+	ch <- c.errors
+	ch <- c.bytes
+	ch <- c.inflight
+	ch <- c.urls
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.crawler.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, float64(stats.Requests))
+	for _, kind := range errKinds {
+		ch <- prometheus.MustNewConstMetric(c.errors, prometheus.CounterValue, float64(stats.ErrorsByKind[kind]), strings.ReplaceAll(kind.String(), " ", "_"))
+	}
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.CounterValue, float64(stats.Bytes))
+	ch <- prometheus.MustNewConstMetric(c.inflight, prometheus.GaugeValue, float64(stats.Running))
+	ch <- prometheus.MustNewConstMetric(c.urls, prometheus.GaugeValue, float64(stats.Pending), "pending")
+	ch <- prometheus.MustNewConstMetric(c.urls, prometheus.GaugeValue, float64(stats.Running), "running")
+	ch <- prometheus.MustNewConstMetric(c.urls, prometheus.GaugeValue, float64(stats.Rejected), "rejected")
+	ch <- prometheus.MustNewConstMetric(c.urls, prometheus.GaugeValue, float64(stats.Done), "done")
+}
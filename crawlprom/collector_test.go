@@ -0,0 +1,66 @@
+package crawlprom
+
+import (
+	"testing"
+
+	"github.com/phayes/crawlbot"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	crawler := &crawlbot.Crawler{
+		URLs:       []string{"http://example.com/"},
+		NumWorkers: 1,
+		Handler:    func(resp *crawlbot.Response) {},
+		Client: crawlbot.NewMockClient(map[string]crawlbot.MockResponse{
+			"http://example.com/": {Body: `<a href="/missing">missing</a>`},
+		}),
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewCollector(crawler))
+
+	// The collector can be registered and gathered before the crawler is started
+	if _, err := registry.Gather(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := crawler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	crawler.Wait()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			for _, label := range metric.GetLabel() {
+				name += "/" + label.GetValue()
+			}
+			if counter := metric.GetCounter(); counter != nil {
+				values[name] = counter.GetValue()
+			} else {
+				values[name] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+
+	expected := map[string]float64{
+		"crawlbot_requests_total":                 2,
+		"crawlbot_errors_total/other":             1,
+		"crawlbot_errors_total/too_many_requests": 0,
+		"crawlbot_bytes_total":                    float64(len(`<a href="/missing">missing</a>`)),
+		"crawlbot_in_flight":                      0,
+		"crawlbot_urls/done":                      1,
+		"crawlbot_urls/rejected":                  1,
+		"crawlbot_urls/pending":                   0,
+	}
+	for name, value := range expected {
+		if got, ok := values[name]; !ok || got != value {
+			t.Errorf("Expected %s to be %v, got %v", name, value, got)
+		}
+	}
+}
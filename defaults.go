@@ -3,19 +3,29 @@ package crawlbot
 import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/phayes/errors"
+	"log"
 	"mime"
+	"net"
 	"net/http"
 	"net/url"
+	"path"
 	"strconv"
+	"strings"
 	"time"
 )
 
-// The default URL Checker constrains the crawler to the domains of the seed URLs
+// The default URL Checker constrains the crawler to the domains of the seed URLs, and rejects URLs on the deny list
 func defaultCheckURL(crawler *Crawler, checkurl string) error {
 	parsedURL, err := url.Parse(checkurl)
 	if err != nil {
 		return err
 	}
+	if list, _ := crawler.denylist.Load().(*denyList); list != nil && list.denies(checkurl, parsedURL) {
+		return ErrDenied
+	}
+	if err := checkExtension(crawler, parsedURL); err != nil {
+		return err
+	}
 	for _, seedURL := range crawler.URLs {
 		parsedSeed, err := url.Parse(seedURL)
 		if err != nil {
@@ -28,6 +38,25 @@ func defaultCheckURL(crawler *Crawler, checkurl string) error {
 	return errors.New("URL not in approved domain")
 }
 
+// Check the extension of a URL's path against AllowedExtensions and DeniedExtensions
+func checkExtension(crawler *Crawler, parsedURL *url.URL) error {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(parsedURL.Path), "."))
+	for _, denied := range crawler.DeniedExtensions {
+		if ext == strings.ToLower(strings.TrimPrefix(denied, ".")) {
+			return errors.New("URL extension is denied")
+		}
+	}
+	if ext == "" || len(crawler.AllowedExtensions) == 0 {
+		return nil
+	}
+	for _, allowed := range crawler.AllowedExtensions {
+		if ext == strings.ToLower(strings.TrimPrefix(allowed, ".")) {
+			return nil
+		}
+	}
+	return errors.New("URL extension is not allowed")
+}
+
 // The default header checker will only proceed if it's 200 OK and an HTML Content-Type
 func defaultCheckHeader(crawler *Crawler, url string, status int, header http.Header) error {
 	if status != 200 {
@@ -51,42 +80,107 @@ func defaultCheckHeader(crawler *Crawler, url string, status int, header http.He
 	}
 }
 
-// The default link finder finds all <a href> links in an HMTL document
+// The default link finder finds all <a href> links in an HMTL document, restricted by FollowSelector if it is set
 func defaultLinkFinder(resp *Response) []string {
 	var newurls = make([]string, 0)
 
-	if defaultCheckHeader(resp.Crawler, resp.URL, resp.StatusCode, resp.Header) != nil {
+	doc := resp.document()
+	if doc == nil {
 		return newurls
 	}
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	parsedURL, err := url.Parse(resp.URL)
 	if err != nil {
 		return newurls
 	}
 
-	parsedURL, err := url.Parse(resp.URL)
-	if err != nil {
-		return newurls
+	anchors := doc.Find("a")
+	if resp.Crawler.FollowSelector != "" {
+		matches := doc.Find(resp.Crawler.FollowSelector)
+		anchors = matches.Filter("a").AddSelection(matches.Find("a"))
 	}
 
-	doc.Find("a:not([rel='nofollow'])").Each(func(i int, s *goquery.Selection) {
+	anchors.Not("[rel='nofollow']").Each(func(i int, s *goquery.Selection) {
 		link, ok := s.Attr("href")
-		if ok {
-			parsedLink, err := url.Parse(link)
-			parsedLink.Fragment = "" // Unset the #fragment if it exists
-			if err == nil {
-				absLink := parsedURL.ResolveReference(parsedLink)
-				newurls = append(newurls, absLink.String())
+		if !ok {
+			return
+		}
+		resolved, ok := resp.Crawler.ResolveURL(parsedURL, link)
+		if !ok {
+			return
+		}
+		if resp.Crawler.SkipSelfLinks {
+			absLink, err := url.Parse(resolved)
+			if err == nil && absLink.Scheme == parsedURL.Scheme && absLink.Host == parsedURL.Host && absLink.Path == parsedURL.Path {
+				return
 			}
 		}
+		newurls = append(newurls, resolved)
 	})
 
 	return newurls
 }
 
-// The default client is the built-in net/http Client with a 15 second timeout
-func defaultClient() *http.Client {
+// The default URL resolver resolves the link against the base URL and removes any #fragment
+func defaultResolveURL(base *url.URL, link string) (string, bool) {
+	parsedLink, err := url.Parse(link)
+	if err != nil {
+		return "", false
+	}
+	parsedLink.Fragment = ""
+	return base.ResolveReference(parsedLink).String(), true
+}
+
+// The default ShouldParseHTML parses 200 responses that are HTML. A sniffed content type is trusted over the Content-Type header.
+func defaultShouldParseHTML(resp *Response) bool {
+	if resp.DetectedContentType == "" {
+		return defaultCheckHeader(resp.Crawler, resp.URL, resp.StatusCode, resp.Header) == nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.DetectedContentType)
+	if err != nil {
+		return false
+	}
+	return resp.StatusCode == 200 && mediaType == "text/html"
+}
+
+// The default slow handler logs a warning
+func defaultSlowHandler(crawler *Crawler, url string, elapsed time.Duration) {
+	log.Printf("crawlbot: Handler for %s took %s", url, elapsed)
+}
+
+// The default client is the built-in net/http Client with a 15 second timeout.
+// All default clients share the crawler's transport, so that connections are pooled across workers.
+func (c *Crawler) defaultClient() *http.Client {
 	return &http.Client{
-		Timeout: 15 * time.Second,
+		Timeout:   15 * time.Second,
+		Transport: c.transport,
+	}
+}
+
+// Create the transport shared by default clients. It is a clone of http.DefaultTransport, but with the dialer and
+// proxy configured by the crawler.
+func (c *Crawler) newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = c.dialer().DialContext
+	transport.ProxyConnectHeader = c.ProxyConnectHeader
+	if c.Proxy != nil {
+		transport.Proxy = http.ProxyURL(c.Proxy)
+	}
+	return transport
+}
+
+// Create the dialer for the default transport, using DialTimeout and DialKeepAlive
+func (c *Crawler) dialer() *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if c.DialTimeout != 0 {
+		dialer.Timeout = c.DialTimeout
+	}
+	if c.DialKeepAlive != 0 {
+		dialer.KeepAlive = c.DialKeepAlive
 	}
+	return dialer
 }
@@ -0,0 +1,255 @@
+package crawlbot
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"github.com/PuerkitoBio/goquery"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Create a parsed HTML Response for testing link finders without a crawl
+func htmlResponse(t *testing.T, pageURL, body string, crawler *Crawler) *Response {
+	t.Helper()
+	if crawler.ResolveURL == nil {
+		crawler.ResolveURL = defaultResolveURL
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Response{URL: pageURL, Crawler: crawler, bytes: []byte(body), Doc: doc, parsed: true}
+}
+
+func TestFollowSelector(t *testing.T) {
+	body := `<nav><a href="/nav">nav</a></nav><div id="content"><a href="/one">one</a><p><a href="/two">two</a></p></div><a id="content" href="/three">three</a>`
+	resp := htmlResponse(t, "http://example.com/", body, &Crawler{FollowSelector: "#content"})
+
+	links := defaultLinkFinder(resp)
+	sort.Strings(links)
+	expected := "http://example.com/one http://example.com/three http://example.com/two"
+	if strings.Join(links, " ") != expected {
+		t.Errorf("Expected %s, got %v", expected, links)
+	}
+}
+
+func TestSkipSelfLinks(t *testing.T) {
+	body := `<a href="#top">top</a><a href="?page=2">query</a><a href="/page">self</a><a href="/other">other</a><a href="https://example.com/page">scheme</a>`
+	tests := []struct {
+		skip     bool
+		expected int
+	}{
+		{false, 5},
+		{true, 2},
+	}
+	for _, test := range tests {
+		resp := htmlResponse(t, "http://example.com/page", body, &Crawler{SkipSelfLinks: test.skip})
+		if links := defaultLinkFinder(resp); len(links) != test.expected {
+			t.Errorf("SkipSelfLinks %v: expected %d links, got %v", test.skip, test.expected, links)
+		}
+	}
+}
+
+func TestNoFollowLinks(t *testing.T) {
+	resp := htmlResponse(t, "http://example.com/", `<a href="/a">a</a><a rel="nofollow" href="/b">b</a>`, &Crawler{})
+	if links := defaultLinkFinder(resp); len(links) != 1 || links[0] != "http://example.com/a" {
+		t.Errorf("Expected rel=nofollow links to be skipped, got %v", links)
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	crawler := &Crawler{
+		ResolveURL: func(base *url.URL, link string) (string, bool) {
+			if strings.HasPrefix(link, "javascript:") {
+				return "", false
+			}
+			resolved, ok := defaultResolveURL(base, link)
+			return strings.ToLower(resolved), ok
+		},
+	}
+	resp := htmlResponse(t, "http://example.com/dir/", `<a href="Page#frag">a</a><a href="javascript:void(0)">js</a>`, crawler)
+	if links := defaultLinkFinder(resp); len(links) != 1 || links[0] != "http://example.com/dir/page" {
+		t.Errorf("Expected links to be built by ResolveURL, got %v", links)
+	}
+
+	base, _ := url.Parse("http://example.com/a/b")
+	if resolved, ok := defaultResolveURL(base, "../c#frag"); !ok || resolved != "http://example.com/c" {
+		t.Errorf("Expected the default resolver to resolve relative links and drop fragments, got %s", resolved)
+	}
+}
+
+func TestCheckExtensions(t *testing.T) {
+	crawler := &Crawler{URLs: []string{"http://example.com/"}, AllowedExtensions: []string{"html", ".php"}, DeniedExtensions: []string{"PDF"}}
+	tests := map[string]bool{
+		"http://example.com/":           true,
+		"http://example.com/about":      true,
+		"http://example.com/index.html": true,
+		"http://example.com/index.PHP":  true,
+		"http://example.com/image.png":  false,
+		"http://example.com/doc.pdf":    false,
+		"http://other.com/index.html":   false,
+	}
+	for checkurl, allowed := range tests {
+		if err := defaultCheckURL(crawler, checkurl); (err == nil) != allowed {
+			t.Errorf("%s: expected allowed %v, got %v", checkurl, allowed, err)
+		}
+	}
+}
+
+func TestCheckHeader(t *testing.T) {
+	tests := []struct {
+		status      int
+		contentType string
+		err         error
+	}{
+		{200, "text/html; charset=utf-8", nil},
+		{200, "application/xhtml+xml", nil},
+		{404, "text/html", ErrBadHttpCode},
+		{200, "", ErrBadContentType},
+		{200, "image/png", ErrBadContentType},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		if test.contentType != "" {
+			header.Set("Content-Type", test.contentType)
+		}
+		err := defaultCheckHeader(nil, "http://example.com/", test.status, header)
+		if (test.err == nil && err != nil) || (test.err != nil && !isErr(err, test.err)) {
+			t.Errorf("%d %q: expected %v, got %v", test.status, test.contentType, test.err, err)
+		}
+	}
+}
+
+func TestDialTuning(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	// A dial timeout too short for any connection to be made shows that the dialer is used
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{server.URL + "/"}, NumWorkers: 1, DialTimeout: time.Nanosecond, Handler: rec.handle}
+	crawl(t, c)
+	if resp := rec.get(server.URL + "/"); resp == nil || !isErr(resp.Err, ErrReqFailed) || !strings.Contains(resp.Err.Error(), "i/o timeout") {
+		t.Errorf("Expected the dial to time out, got %v", resp)
+	}
+
+	c = &Crawler{DialTimeout: time.Second, DialKeepAlive: time.Minute}
+	if dialer := c.dialer(); dialer.Timeout != time.Second || dialer.KeepAlive != time.Minute {
+		t.Errorf("Expected the dialer to use DialTimeout and DialKeepAlive, got %s and %s", dialer.Timeout, dialer.KeepAlive)
+	}
+	c = &Crawler{}
+	if dialer := c.dialer(); dialer.Timeout != 30*time.Second || dialer.KeepAlive != 30*time.Second {
+		t.Errorf("Expected the dialer to default to 30 seconds, got %s and %s", dialer.Timeout, dialer.KeepAlive)
+	}
+}
+
+func TestSharedTransport(t *testing.T) {
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 2, Handler: rec.handle, Client: NewMockClient(testSite)}
+	crawl(t, c)
+
+	first, second := c.defaultClient(), c.defaultClient()
+	if first.Transport == nil || first.Transport != second.Transport {
+		t.Fatal("Expected default clients to share a transport")
+	}
+	if transport := first.Transport.(*http.Transport); !transport.ForceAttemptHTTP2 {
+		t.Error("Expected the default transport to attempt HTTP/2")
+	}
+}
+func TestProxy(t *testing.T) {
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	proxied := make(chan string, 10)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != auth {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		proxied <- r.URL.String()
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "secret")
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.invalid/"}, NumWorkers: 1, Proxy: proxyURL, Handler: rec.handle}
+	crawl(t, c)
+
+	if resp := rec.get("http://example.invalid/"); resp == nil || resp.Err != nil {
+		t.Fatalf("Expected the request to succeed through the proxy, got %v", resp)
+	}
+	if requested := <-proxied; requested != "http://example.invalid/" {
+		t.Errorf("Expected the proxy to be sent the absolute URL, got %s", requested)
+	}
+}
+
+func TestProxyConnectTunnel(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("tunnelled"))
+	}))
+	defer target.Close()
+
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	tunnelled := make(chan string, 10)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect || r.Header.Get("Proxy-Authorization") != auth || r.Header.Get("X-Tunnel") != "yes" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tunnelled <- r.Host
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go io.Copy(upstream, bufio.NewReader(buf))
+		io.Copy(conn, upstream)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "secret")
+	pool := x509.NewCertPool()
+	pool.AddCert(target.Certificate())
+	rec := newRecorder()
+	c := &Crawler{
+		URLs:               []string{target.URL + "/"},
+		NumWorkers:         1,
+		Proxy:              proxyURL,
+		ProxyConnectHeader: http.Header{"X-Tunnel": {"yes"}},
+		Handler:            rec.handle,
+	}
+	c.Client = func() *http.Client {
+		client := c.defaultClient()
+		client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: pool}
+		return client
+	}
+	crawl(t, c)
+
+	if resp := rec.get(target.URL + "/"); resp == nil || resp.Err != nil {
+		t.Fatalf("Expected the request to succeed through the tunnel, got %v", resp)
+	}
+	if host := <-tunnelled; host != strings.TrimPrefix(target.URL, "https://") {
+		t.Errorf("Expected a tunnel to %s, got %s", target.URL, host)
+	}
+}
@@ -0,0 +1,93 @@
+package crawlbot
+
+import (
+	"bufio"
+	"github.com/phayes/errors"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A list of hosts and patterns that must never be crawled. See Crawler.LoadDenyList.
+type denyList struct {
+	hosts    map[string]bool  // Exact hosts
+	suffixes []string         // Domain suffixes, including the leading dot
+	patterns []*regexp.Regexp // Patterns matched against the whole URL
+}
+
+// Load a deny list of hosts and patterns that are never crawled. URLs on the list are rejected when they are added,
+// whether as seeds, by Add() or by being found on a page, Recrawl() of them returns ErrDenied, and the default
+// CheckURL never allows them regardless of the domains of the seed URLs. URLs that are already pending when the list
+// is loaded are still crawled. The list has one entry per line. Blank lines and lines starting with # are ignored.
+// Each entry is one of:
+//
+//	example.com             an exact host
+//	.example.com            a domain suffix, matching example.com and all of its subdomains
+//	re:^https?://[^/]+/tmp  a regular expression, prefixed with re:, matched against the whole URL
+//
+// Hosts are matched without their port and case-insensitively. Loading a deny list replaces any previously loaded one.
+// Returns an error wrapping ErrInvalidDenyList if an entry is malformed, in which case the previous list is kept.
+func (c *Crawler) LoadDenyList(r io.Reader) error {
+	list := &denyList{hosts: make(map[string]bool)}
+
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "re:"):
+			pattern, err := regexp.Compile(strings.TrimPrefix(line, "re:"))
+			if err != nil {
+				return errors.Appends(ErrInvalidDenyList, "line "+strconv.Itoa(lineno)+": "+err.Error())
+			}
+			list.patterns = append(list.patterns, pattern)
+		case strings.ContainsAny(line, "/: \t"):
+			return errors.Appends(ErrInvalidDenyList, "line "+strconv.Itoa(lineno)+": "+strconv.Quote(line)+" is not a host")
+		case strings.HasPrefix(line, "."):
+			list.suffixes = append(list.suffixes, strings.ToLower(line))
+		default:
+			list.hosts[strings.ToLower(line)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, ErrInvalidDenyList)
+	}
+
+	c.denylist.Store(list)
+	return nil
+}
+
+// Check if a URL is on the deny list, if one is loaded
+func (c *Crawler) denied(rawurl string) bool {
+	list, _ := c.denylist.Load().(*denyList)
+	if list == nil {
+		return false
+	}
+	parsedURL, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	return list.denies(rawurl, parsedURL)
+}
+
+// Check if a URL is on the deny list
+func (d *denyList) denies(rawurl string, parsedURL *url.URL) bool {
+	host := strings.ToLower(parsedURL.Hostname())
+	if d.hosts[host] {
+		return true
+	}
+	for _, suffix := range d.suffixes {
+		if host == suffix[1:] || strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	for _, pattern := range d.patterns {
+		if pattern.MatchString(rawurl) {
+			return true
+		}
+	}
+	return false
+}
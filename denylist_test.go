@@ -0,0 +1,80 @@
+package crawlbot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadDenyList(t *testing.T) {
+	c := &Crawler{}
+	list := `
+# Ads
+ads.example.com
+.tracker.com
+re:/private/
+`
+	if err := c.LoadDenyList(strings.NewReader(list)); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"http://example.com/":               false,
+		"http://ADS.example.com:8080/":      true,
+		"http://tracker.com/":               true,
+		"http://cdn.tracker.com/pixel":      true,
+		"http://nottracker.com/":            false,
+		"http://example.com/private/report": true,
+	}
+	for url, denied := range tests {
+		if c.denied(url) != denied {
+			t.Errorf("%s: expected denied %v", url, denied)
+		}
+	}
+
+	for _, invalid := range []string{"http://example.com/", "re:(", "two hosts"} {
+		if err := c.LoadDenyList(strings.NewReader(invalid)); !isErr(err, ErrInvalidDenyList) {
+			t.Errorf("%q: expected ErrInvalidDenyList, got %v", invalid, err)
+		}
+	}
+	if !c.denied("http://ads.example.com/") {
+		t.Error("Expected an invalid deny list to keep the previous one")
+	}
+}
+
+func TestDenyListCrawl(t *testing.T) {
+	transport := newTestTransport(withHold(testSite))
+	release := make(chan bool)
+	c := &Crawler{
+		URLs:       []string{"http://example.com/", holdURL},
+		NumWorkers: 2,
+		Client:     transport.client,
+		Handler: func(resp *Response) {
+			if resp.URL == holdURL {
+				<-release
+			}
+		},
+		// Allow everything so that only the deny list keeps URLs out
+		CheckURL: func(crawler *Crawler, url string) error { return nil },
+	}
+	if err := c.LoadDenyList(strings.NewReader("other.com\nre:/b$")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, c, "http://example.com/c", StateDone)
+	c.Add("http://other.com/added")
+	if err := c.Recrawl("http://example.com/b"); err != ErrDenied {
+		t.Errorf("Expected Recrawl of a denied URL to return ErrDenied, got %v", err)
+	}
+	close(release)
+	waitFor(t, c)
+
+	for _, url := range []string{"http://other.com/", "http://other.com/added", "http://example.com/b"} {
+		if n := transport.count(url); n != 0 {
+			t.Errorf("Expected denied URL %s not to be fetched, got %d requests", url, n)
+		}
+		if state := c.State(url); state != StateRejected {
+			t.Errorf("Expected denied URL %s to be rejected, got %v", url, state)
+		}
+	}
+}
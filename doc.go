@@ -2,7 +2,7 @@
 Crawlbot is a simple, efficient, and flexible webcrawler / spider. Crawlbot is easy to use out-of-the-box, but also provides extensive flexibility for advanced users.
 
 	func main() {
-		crawler := NewCrawler("http://cnn.com", myURLHandler, 4)
+		crawler := crawlbot.NewCrawler("http://cnn.com", myURLHandler, 4)
 		crawler.Start()
 		crawler.Wait()
 	}
@@ -35,19 +35,16 @@ CrawlBot provides extensive customizability for advances use cases. Please see d
 		}
 
 		if resp.Doc != nil {
-			title, err := resp.Doc.Search("//title")
-			if err != nil {
-				log.Println(err)
-			}
-			fmt.Printf("Title of %s is %s\n", resp.URL, title[0].Content())
+			title := resp.Doc.Find("title").First().Text()
+			fmt.Printf("Title of %s is %s\n", resp.URL, title)
 		} else {
 			fmt.Println("HTML was not parsed for " + resp.URL)
 		}
 	}
 
 	// Crawl everything!
-	func AllowEverything(crawler *crawlbot.Crawler, url string) bool {
-		return true
+	func AllowEverything(crawler *crawlbot.Crawler, url string) error {
+		return nil
 	}
 */
 package crawlbot
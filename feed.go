@@ -0,0 +1,87 @@
+package crawlbot
+
+import (
+	"encoding/xml"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// The elements of RSS 2.0, RSS 1.0 and Atom feeds that hold item links
+type feed struct {
+	XMLName  xml.Name
+	Items    []rssItem   `xml:"channel>item"` // RSS 2.0
+	RDFItems []rssItem   `xml:"item"`         // RSS 1.0
+	Entries  []atomEntry `xml:"entry"`        // Atom
+}
+
+type rssItem struct {
+	Link string `xml:"link"`
+}
+
+type atomEntry struct {
+	Links []atomLink `xml:"link"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+// A LinkFinder that finds the item links in RSS and Atom feeds. A response is treated as a feed if it has an
+// application/rss+xml or application/atom+xml content type, or if its root element is <rss>, <rdf:RDF> or <feed>.
+// For other responses FeedLinkFinder returns no links, so it can be combined with another LinkFinder by
+// calling both. Note that the default CheckHeader rejects anything other than HTML, so a CheckHeader
+// that allows feeds is also needed.
+func FeedLinkFinder(resp *Response) []string {
+	var newurls = make([]string, 0)
+
+	var f feed
+	if err := xml.Unmarshal(resp.bytes, &f); err != nil {
+		return newurls
+	}
+	if !isFeed(resp, f.XMLName) {
+		return newurls
+	}
+
+	base, err := url.Parse(resp.URL)
+	if err != nil {
+		return newurls
+	}
+
+	links := make([]string, 0)
+	for _, item := range append(f.Items, f.RDFItems...) {
+		links = append(links, strings.TrimSpace(item.Link))
+	}
+	for _, entry := range f.Entries {
+		for _, link := range entry.Links {
+			if link.Rel == "" || link.Rel == "alternate" {
+				links = append(links, link.Href)
+			}
+		}
+	}
+
+	for _, link := range links {
+		if link == "" {
+			continue
+		}
+		if resolved, ok := resp.Crawler.ResolveURL(base, link); ok {
+			newurls = append(newurls, resolved)
+		}
+	}
+
+	return newurls
+}
+
+// Check if a response is a feed, from its content type or its root element
+func isFeed(resp *Response, root xml.Name) bool {
+	if resp.Response != nil {
+		mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if err == nil && (mediaType == "application/rss+xml" || mediaType == "application/atom+xml") {
+			return true
+		}
+	}
+	return root.Local == "rss" || root.Local == "RDF" || (root.Local == "feed" && root.Space == atomNamespace)
+}
@@ -0,0 +1,36 @@
+package crawlbot
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFeedLinkFinder(t *testing.T) {
+	crawler := &Crawler{ResolveURL: defaultResolveURL}
+	tests := []struct {
+		contentType string
+		body        string
+		expected    string
+	}{
+		{"application/rss+xml", `<rss><channel><item><link> http://example.com/a </link></item><item><link>/b</link></item></channel></rss>`, "http://example.com/a http://example.com/b"},
+		{"text/xml", `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><item><link>/a</link></item></rdf:RDF>`, "http://example.com/a"},
+		{"text/xml", `<feed xmlns="http://www.w3.org/2005/Atom"><entry><link href="/a"/><link rel="edit" href="/edit"/></entry><entry><link rel="alternate" href="/b"/></entry></feed>`, "http://example.com/a http://example.com/b"},
+		{"text/xml", `<feed><entry><link href="/a"/></entry></feed>`, ""},
+		{"text/html", `<html><a href="/a">a</a></html>`, ""},
+	}
+	for _, test := range tests {
+		resp := &Response{
+			Response: &http.Response{Header: http.Header{"Content-Type": {test.contentType}}},
+			URL:      "http://example.com/feed",
+			Crawler:  crawler,
+			bytes:    []byte(test.body),
+		}
+		links := FeedLinkFinder(resp)
+		sort.Strings(links)
+		if strings.Join(links, " ") != test.expected {
+			t.Errorf("%s: expected %q, got %v", test.body, test.expected, links)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package crawlbot
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Work out when a response received at now stops being fresh from its Cache-Control, Expires and Age headers.
+// A max-age in Cache-Control takes precedence over Expires. Responses marked no-cache or no-store are stale as soon as
+// they are received, as is one with an invalid Expires. Returns the zero time if there is no freshness information.
+func freshUntil(header http.Header, now time.Time) time.Time {
+	maxAge := -1
+	for _, directive := range strings.Split(strings.ToLower(header.Get("Cache-Control")), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch name {
+		case "no-cache", "no-store":
+			return now
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds >= 0 {
+				maxAge = seconds
+			}
+		}
+	}
+
+	if maxAge >= 0 {
+		// Age is how long the response already spent in caches on the way here
+		age, _ := strconv.Atoi(header.Get("Age"))
+		if age >= maxAge {
+			return now
+		}
+		return now.Add(time.Duration(maxAge-age) * time.Second)
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil || t.Before(now) {
+			return now
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,50 @@
+package crawlbot
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFreshUntil(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header   http.Header
+		expected time.Time
+	}{
+		{http.Header{}, time.Time{}},
+		{http.Header{"Cache-Control": {"public, max-age=3600"}}, now.Add(time.Hour)},
+		{http.Header{"Cache-Control": {"max-age=3600"}, "Age": {"600"}}, now.Add(50 * time.Minute)},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Age": {"600"}}, now},
+		{http.Header{"Cache-Control": {"max-age=0"}}, now},
+		{http.Header{"Cache-Control": {"no-cache"}}, now},
+		{http.Header{"Cache-Control": {"max-age=3600, No-Store"}}, now},
+		{http.Header{"Expires": {"Tue, 02 Jan 2024 12:00:00 GMT"}}, now.Add(24 * time.Hour)},
+		{http.Header{"Expires": {"Sun, 31 Dec 2023 12:00:00 GMT"}}, now},
+		{http.Header{"Expires": {"0"}}, now},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Expires": {"Tue, 02 Jan 2024 12:00:00 GMT"}}, now.Add(time.Minute)},
+	}
+	for _, test := range tests {
+		if got := freshUntil(test.header, now); !got.Equal(test.expected) {
+			t.Errorf("%v: expected %s, got %s", test.header, test.expected, got)
+		}
+	}
+}
+
+func TestResponseFreshUntil(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/":  {Header: http.Header{"Content-Type": {"text/html"}, "Cache-Control": {"max-age=3600"}}, Body: `<a href="/a">a</a>`},
+		"http://example.com/a": {Header: http.Header{"Content-Type": {"text/html"}, "Cache-Control": {"no-store"}}},
+	}
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 1, Handler: rec.handle, Client: NewMockClient(pages)}
+	start := time.Now()
+	crawl(t, c)
+
+	if fresh := rec.get("http://example.com/").FreshUntil; fresh.Before(start.Add(time.Hour)) || fresh.After(time.Now().Add(time.Hour)) {
+		t.Errorf("Expected a page with a max-age of an hour to be fresh for an hour, got %s", fresh)
+	}
+	if fresh := rec.get("http://example.com/a").FreshUntil; fresh.Before(start) || fresh.After(time.Now()) {
+		t.Errorf("Expected a no-store page to be stale when it was received, got %s", fresh)
+	}
+}
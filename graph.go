@@ -0,0 +1,58 @@
+package crawlbot
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Node colors used by WriteDOT, by URL state.
+var dotColors = map[State]string{
+	StatePending:  "gray",
+	StateRunning:  "yellow",
+	StateRejected: "red",
+	StateDone:     "green",
+}
+
+// Write the link graph of the crawl to w in Graphviz DOT format.
+// Nodes are colored by their current state: green for done, red for rejected, yellow for running and gray for pending.
+// RecordLinkGraph must be set for links to be recorded. The entire graph is written, so on large crawls
+// the output may be too large for Graphviz to render usefully.
+func (c *Crawler) WriteDOT(w io.Writer) error {
+	frontier := c.frontier()
+	states := frontier.snapshot()
+	nodes := make([]string, 0, len(states))
+	for url := range states {
+		nodes = append(nodes, url)
+	}
+	sort.Strings(nodes)
+
+	frontier.RLock()
+	links := make(map[string][]string, len(frontier.links))
+	for url, targets := range frontier.links {
+		links[url] = targets
+	}
+	frontier.RUnlock()
+
+	buf := bufio.NewWriter(w)
+	buf.WriteString("digraph crawl {\n")
+	for _, url := range nodes {
+		buf.WriteString("\t" + dotQuote(url) + " [color=" + dotColors[states[url]] + "];\n")
+	}
+	for _, url := range nodes {
+		for _, target := range links[url] {
+			buf.WriteString("\t" + dotQuote(url) + " -> " + dotQuote(target) + ";\n")
+		}
+	}
+	buf.WriteString("}\n")
+
+	return buf.Flush()
+}
+
+// Quote a string as a DOT ID
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
@@ -0,0 +1,43 @@
+package crawlbot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteDOT(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/a": {Body: `<a href="/b">b</a><a href="/c">c</a>`},
+		"http://example.com/b": {},
+		"http://example.com/c": {StatusCode: 404},
+	}
+	c := &Crawler{URLs: []string{"http://example.com/a"}, NumWorkers: 1, RecordLinkGraph: true, Handler: func(resp *Response) {}, Client: NewMockClient(pages)}
+	crawl(t, c)
+
+	var buf bytes.Buffer
+	if err := c.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	for _, line := range []string{
+		"digraph crawl {\n",
+		"\t\"http://example.com/a\" [color=green];\n",
+		"\t\"http://example.com/c\" [color=red];\n",
+		"\t\"http://example.com/a\" -> \"http://example.com/b\";\n",
+		"\t\"http://example.com/a\" -> \"http://example.com/c\";\n",
+	} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("Expected DOT output to contain %q, got:\n%s", line, dot)
+		}
+	}
+	if !strings.HasPrefix(dot, "digraph crawl {\n") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("Expected a complete digraph, got:\n%s", dot)
+	}
+}
+
+func TestDotQuote(t *testing.T) {
+	if quoted := dotQuote(`http://example.com/"quoted"\path`); quoted != `"http://example.com/\"quoted\"\\path"` {
+		t.Errorf("Expected quotes and backslashes to be escaped, got %s", quoted)
+	}
+}
@@ -0,0 +1,165 @@
+package crawlbot
+
+import (
+	"encoding/json"
+	"github.com/phayes/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A crawl job definition as read by LoadJob. Durations are strings in time.ParseDuration format, eg. "500ms".
+type job struct {
+	URLs                  []string          `json:"urls"`
+	NumWorkers            int               `json:"num_workers"`
+	MaxConcurrentRequests int               `json:"max_concurrent_requests"`
+	PerWorkerDelay        string            `json:"per_worker_delay"`
+	CrawlDelay            string            `json:"crawl_delay"`
+	Persistent            bool              `json:"persistent"`
+	DrainTimeout          string            `json:"drain_timeout"`
+	RespectRobots         bool              `json:"respect_robots"`
+	UserAgent             string            `json:"user_agent"`
+	Accept                string            `json:"accept"`
+	Headers               map[string]string `json:"headers"`
+	QueueOrder            string            `json:"queue_order"`
+	MaxHosts              int               `json:"max_hosts"`
+	MaxDepth              int               `json:"max_depth"`
+	MaxRetries            int               `json:"max_retries"`
+	AllowedExtensions     []string          `json:"allowed_extensions"`
+	DeniedExtensions      []string          `json:"denied_extensions"`
+	Deny                  []string          `json:"deny"`
+	FollowSelector        string            `json:"follow_selector"`
+	SkipSelfLinks         bool              `json:"skip_self_links"`
+	Budget                jobBudget         `json:"budget"`
+}
+
+type jobBudget struct {
+	MaxPages    int    `json:"max_pages"`
+	MaxBytes    int64  `json:"max_bytes"`
+	MaxDuration string `json:"max_duration"`
+}
+
+// Load a crawl job definition from JSON and create a Crawler configured by it. Only JSON is supported, so that
+// crawlbot doesn't depend on a YAML parser; convert YAML jobs to JSON first.
+// Hooks such as Handler cannot be defined in a job and must be set on the returned Crawler before it is started.
+// Only "urls" and "num_workers" are required. The full schema, with each field matching the Crawler field of the same name, is:
+//
+//	{
+//		"urls": ["http://example.com"],
+//		"num_workers": 4,
+//		"max_concurrent_requests": 2,
+//		"per_worker_delay": "1s",
+//		"crawl_delay": "500ms",
+//		"persistent": false,
+//		"drain_timeout": "10s",
+//		"respect_robots": true,
+//		"user_agent": "mybot/1.0",
+//		"accept": "text/html",
+//		"headers": {"Authorization": "Bearer token"},
+//		"queue_order": "fifo",
+//		"max_hosts": 10,
+//		"max_depth": 5,
+//		"max_retries": 3,
+//		"allowed_extensions": ["html"],
+//		"denied_extensions": ["pdf"],
+//		"deny": [".ads.example.com", "re:/private/"],
+//		"follow_selector": "#content",
+//		"skip_self_links": true,
+//		"budget": {"max_pages": 1000, "max_bytes": 100000000, "max_duration": "1h"}
+//	}
+//
+// queue_order is either "fifo" or "lifo". headers sets Crawler.Header, and deny is a list of entries in the format
+// read by LoadDenyList. Returns an error wrapping ErrInvalidJob if the job is malformed or invalid.
+func LoadJob(r io.Reader) (*Crawler, error) {
+	var j job
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&j); err != nil {
+		return nil, errors.Wrap(err, ErrInvalidJob)
+	}
+
+	if len(j.URLs) == 0 {
+		return nil, errors.Appends(ErrInvalidJob, "urls is required")
+	}
+	for _, rawurl := range j.URLs {
+		parsed, err := url.Parse(rawurl)
+		if err != nil || !parsed.IsAbs() {
+			return nil, errors.Appends(ErrInvalidJob, "urls contains invalid URL "+strconv.Quote(rawurl))
+		}
+	}
+	if j.NumWorkers <= 0 {
+		return nil, errors.Appends(ErrInvalidJob, "num_workers must be greater than 0")
+	}
+	if j.MaxDepth < 0 {
+		return nil, errors.Appends(ErrInvalidJob, "max_depth must not be negative")
+	}
+
+	crawler := &Crawler{
+		URLs:                  j.URLs,
+		NumWorkers:            j.NumWorkers,
+		MaxConcurrentRequests: j.MaxConcurrentRequests,
+		Persistent:            j.Persistent,
+		RespectRobots:         j.RespectRobots,
+		UserAgent:             j.UserAgent,
+		Accept:                j.Accept,
+		MaxHosts:              j.MaxHosts,
+		MaxDepth:              j.MaxDepth,
+		MaxRetries:            j.MaxRetries,
+		AllowedExtensions:     j.AllowedExtensions,
+		DeniedExtensions:      j.DeniedExtensions,
+		FollowSelector:        j.FollowSelector,
+		SkipSelfLinks:         j.SkipSelfLinks,
+		Budget: Budget{
+			MaxPages: j.Budget.MaxPages,
+			MaxBytes: j.Budget.MaxBytes,
+		},
+	}
+
+	switch j.QueueOrder {
+	case "", "fifo":
+		crawler.QueueOrder = QueueFIFO
+	case "lifo":
+		crawler.QueueOrder = QueueLIFO
+	default:
+		return nil, errors.Appends(ErrInvalidJob, "queue_order must be \"fifo\" or \"lifo\"")
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"per_worker_delay", j.PerWorkerDelay, &crawler.PerWorkerDelay},
+		{"crawl_delay", j.CrawlDelay, &crawler.CrawlDelay},
+		{"drain_timeout", j.DrainTimeout, &crawler.DrainTimeout},
+		{"budget.max_duration", j.Budget.MaxDuration, &crawler.Budget.MaxDuration},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, errors.Appends(ErrInvalidJob, d.name+" is not a valid duration")
+		}
+		*d.field = duration
+	}
+
+	if len(j.Headers) != 0 {
+		crawler.Header = make(http.Header)
+		for name, value := range j.Headers {
+			crawler.Header.Set(name, value)
+		}
+	}
+
+	if len(j.Deny) != 0 {
+		if err := crawler.LoadDenyList(strings.NewReader(strings.Join(j.Deny, "\n"))); err != nil {
+			return nil, errors.Appends(ErrInvalidJob, "deny: "+err.Error())
+		}
+	}
+
+	return crawler, nil
+}
@@ -0,0 +1,71 @@
+package crawlbot
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadJob(t *testing.T) {
+	job := `{
+		"urls": ["http://example.com/"],
+		"num_workers": 4,
+		"max_concurrent_requests": 2,
+		"per_worker_delay": "1s",
+		"crawl_delay": "500ms",
+		"drain_timeout": "10s",
+		"respect_robots": true,
+		"user_agent": "testbot/1.0",
+		"accept": "text/html",
+		"headers": {"x-test": "yes"},
+		"queue_order": "lifo",
+		"max_hosts": 10,
+		"max_depth": 5,
+		"max_retries": 3,
+		"denied_extensions": ["pdf"],
+		"deny": [".ads.example.com", "re:/private/"],
+		"follow_selector": "#content",
+		"skip_self_links": true,
+		"budget": {"max_pages": 1000, "max_bytes": 100000000, "max_duration": "1h"}
+	}`
+	c, err := LoadJob(strings.NewReader(job))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.URLs) != 1 || c.NumWorkers != 4 || c.MaxConcurrentRequests != 2 || !c.RespectRobots || c.MaxHosts != 10 || c.MaxDepth != 5 || c.MaxRetries != 3 {
+		t.Errorf("Job was not loaded correctly: %+v", c)
+	}
+	if c.PerWorkerDelay != time.Second || c.CrawlDelay != 500*time.Millisecond || c.DrainTimeout != 10*time.Second || c.Budget.MaxDuration != time.Hour {
+		t.Errorf("Durations were not loaded correctly: %+v", c)
+	}
+	if c.UserAgent != "testbot/1.0" || c.Accept != "text/html" || c.Header.Get("X-Test") != "yes" {
+		t.Errorf("Headers were not loaded correctly: %+v", c)
+	}
+	if c.QueueOrder != QueueLIFO || c.FollowSelector != "#content" || !c.SkipSelfLinks || c.DeniedExtensions[0] != "pdf" {
+		t.Errorf("Options were not loaded correctly: %+v", c)
+	}
+	if c.Budget.MaxPages != 1000 || c.Budget.MaxBytes != 100000000 {
+		t.Errorf("Budget was not loaded correctly: %+v", c.Budget)
+	}
+	if !c.denied("http://www.ads.example.com/") || !c.denied("http://example.com/private/") || c.denied("http://example.com/") {
+		t.Error("Deny list was not loaded correctly")
+	}
+}
+
+func TestLoadJobInvalid(t *testing.T) {
+	for _, job := range []string{
+		`not json`,
+		`{"num_workers": 1}`,
+		`{"urls": ["/relative"], "num_workers": 1}`,
+		`{"urls": ["http://example.com/"]}`,
+		`{"urls": ["http://example.com/"], "num_workers": 1, "unknown": true}`,
+		`{"urls": ["http://example.com/"], "num_workers": 1, "max_depth": -1}`,
+		`{"urls": ["http://example.com/"], "num_workers": 1, "queue_order": "random"}`,
+		`{"urls": ["http://example.com/"], "num_workers": 1, "crawl_delay": "soon"}`,
+		`{"urls": ["http://example.com/"], "num_workers": 1, "deny": ["re:("]}`,
+	} {
+		if _, err := LoadJob(strings.NewReader(job)); !isErr(err, ErrInvalidJob) {
+			t.Errorf("%s: expected ErrInvalidJob, got %v", job, err)
+		}
+	}
+}
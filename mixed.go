@@ -0,0 +1,54 @@
+package crawlbot
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"net/url"
+)
+
+// Elements that load resources, and the attribute holding the resource URL. Only <link> elements that load a resource
+// count, not those that merely point somewhere such as rel="canonical" or rel="alternate".
+var resourceAttrs = []struct {
+	selector string
+	attr     string
+}{
+	{"img[src], script[src], iframe[src], audio[src], video[src], source[src], embed[src], track[src]", "src"},
+	{"link[rel~=stylesheet][href], link[rel~=icon][href], link[rel~=apple-touch-icon][href], link[rel~=preload][href], link[rel~=modulepreload][href]", "href"},
+	{"object[data]", "data"},
+}
+
+// Find resources loaded over http:// by an HTTPS page. The page's URL is the one it was finally served from after
+// any redirects.
+func findMixedContent(resp *Response) []string {
+	var pageURL *url.URL
+	if resp.Request != nil && resp.Request.URL != nil {
+		pageURL = resp.Request.URL
+	} else {
+		parsed, err := url.Parse(resp.URL)
+		if err != nil {
+			return nil
+		}
+		pageURL = parsed
+	}
+	if pageURL.Scheme != "https" {
+		return nil
+	}
+	doc := resp.document()
+	if doc == nil {
+		return nil
+	}
+
+	var mixed []string
+	for _, resource := range resourceAttrs {
+		doc.Find(resource.selector).Each(func(i int, s *goquery.Selection) {
+			link, _ := s.Attr(resource.attr)
+			parsedLink, err := url.Parse(link)
+			if err != nil {
+				return
+			}
+			if absLink := pageURL.ResolveReference(parsedLink); absLink.Scheme == "http" {
+				mixed = append(mixed, absLink.String())
+			}
+		})
+	}
+	return mixed
+}
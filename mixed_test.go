@@ -0,0 +1,42 @@
+package crawlbot
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMixedContent(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/": {StatusCode: http.StatusMovedPermanently, Header: http.Header{"Location": {"https://example.com/"}}},
+		"https://example.com/": {Body: `
+			<link rel="canonical" href="http://example.com/">
+			<link rel="stylesheet" href="http://cdn.example.com/style.css">
+			<img src="http://cdn.example.com/logo.png">
+			<img src="/local.png">
+			<script src="https://cdn.example.com/app.js"></script>
+			<a href="http://example.com/page">link</a>`},
+		"http://example.com/plain": {Body: `<img src="http://cdn.example.com/logo.png">`},
+	}
+	c := &Crawler{
+		URLs:              []string{"http://example.com/", "http://example.com/plain"},
+		NumWorkers:        1,
+		TrackMixedContent: true,
+		Handler:           func(resp *Response) {},
+		LinkFinder:        func(resp *Response) []string { return nil },
+		Client:            NewMockClient(pages),
+	}
+	crawl(t, c)
+
+	mixed := c.MixedContent()
+	resources := mixed["http://example.com/"]
+	sort.Strings(resources)
+	expected := "http://cdn.example.com/logo.png http://cdn.example.com/style.css"
+	if strings.Join(resources, " ") != expected {
+		t.Errorf("Expected the page redirected to HTTPS to load %s insecurely, got %v", expected, resources)
+	}
+	if _, ok := mixed["http://example.com/plain"]; ok || len(mixed) != 1 {
+		t.Errorf("Expected only the HTTPS page to be reported, got %v", mixed)
+	}
+}
@@ -0,0 +1,66 @@
+package crawlbot
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A canned response served by a client created with NewMockClient
+type MockResponse struct {
+	// The HTTP status code. Defaults to 200 OK.
+	StatusCode int
+
+	// The response headers. If there is no Content-Type header it defaults to "text/html; charset=utf-8".
+	Header http.Header
+
+	// The response body
+	Body string
+}
+
+// Create a Client function that serves canned responses instead of making network requests.
+// Responses are looked up by the full URL of the request, and URLs not in responses get a 404 Not Found.
+// Redirects can be simulated with a 3xx StatusCode and a Location header.
+// Set this as Crawler.Client to test your CheckURL, LinkFinder and Handler logic deterministically, without sockets.
+func NewMockClient(responses map[string]MockResponse) func() *http.Client {
+	transport := &mockTransport{responses: responses}
+	return func() *http.Client {
+		return &http.Client{Transport: transport}
+	}
+}
+
+// mockTransport is an http.RoundTripper that serves MockResponses
+type mockTransport struct {
+	responses map[string]MockResponse
+}
+
+func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	mock, ok := t.responses[req.URL.String()]
+	if !ok {
+		mock = MockResponse{StatusCode: http.StatusNotFound, Body: "Not Found"}
+	}
+	if mock.StatusCode == 0 {
+		mock.StatusCode = http.StatusOK
+	}
+
+	header := make(http.Header)
+	for key, values := range mock.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "text/html; charset=utf-8")
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(mock.StatusCode) + " " + http.StatusText(mock.StatusCode),
+		StatusCode:    mock.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(mock.Body)),
+		ContentLength: int64(len(mock.Body)),
+		Request:       req,
+	}, nil
+}
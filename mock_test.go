@@ -0,0 +1,55 @@
+package crawlbot
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestMockClient(t *testing.T) {
+	client := NewMockClient(map[string]MockResponse{
+		"http://example.com/":     {Body: "home"},
+		"http://example.com/json": {StatusCode: http.StatusCreated, Header: http.Header{"Content-Type": {"application/json"}}, Body: "{}"},
+	})()
+
+	tests := []struct {
+		url         string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"http://example.com/", 200, "text/html; charset=utf-8", "home"},
+		{"http://example.com/json", 201, "application/json", "{}"},
+		{"http://example.com/missing", 404, "text/html; charset=utf-8", "Not Found"},
+	}
+	for _, test := range tests {
+		resp, err := client.Get(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != test.status || resp.Header.Get("Content-Type") != test.contentType || string(body) != test.body {
+			t.Errorf("%s: expected %d %q %q, got %d %q %q", test.url, test.status, test.contentType, test.body, resp.StatusCode, resp.Header.Get("Content-Type"), body)
+		}
+		if resp.Request == nil || resp.Request.URL.String() != test.url {
+			t.Errorf("%s: expected the response to carry its request", test.url)
+		}
+	}
+}
+
+func TestMockClientRedirect(t *testing.T) {
+	client := NewMockClient(map[string]MockResponse{
+		"http://example.com/old": {StatusCode: http.StatusFound, Header: http.Header{"Location": {"/new"}}},
+		"http://example.com/new": {Body: "moved"},
+	})()
+
+	resp, err := client.Get("http://example.com/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Request.URL.String() != "http://example.com/new" {
+		t.Errorf("Expected the redirect to be followed, ended at %s", resp.Request.URL)
+	}
+}
@@ -0,0 +1,75 @@
+package crawlbot
+
+import (
+	"sync"
+)
+
+// A notifier delivers URL state changes to a hook, in order, on its own goroutine.
+// Pushing a state change never blocks, so the hook can't stall the frontier.
+type notifier struct {
+	sync.Mutex
+	hook   func(url string, from, to State)
+	queue  []stateChange // State changes waiting to be delivered
+	wake   chan bool     // Signals the delivery goroutine that there are state changes queued
+	closed bool          // True once the notifier has been closed
+}
+
+type stateChange struct {
+	url  string
+	from State
+	to   State
+}
+
+func newNotifier(hook func(url string, from, to State)) *notifier {
+	n := &notifier{
+		hook: hook,
+		wake: make(chan bool, 1),
+	}
+	go n.run()
+	return n
+}
+
+// Queue a state change for delivery
+func (n *notifier) push(url string, from, to State) {
+	n.Lock()
+	defer n.Unlock()
+
+	if n.closed {
+		return
+	}
+	n.queue = append(n.queue, stateChange{url, from, to})
+	select {
+	case n.wake <- true:
+	default:
+	}
+}
+
+// Close the notifier. State changes already queued are still delivered.
+func (n *notifier) close() {
+	n.Lock()
+	defer n.Unlock()
+
+	if !n.closed {
+		n.closed = true
+		close(n.wake)
+	}
+}
+
+// Deliver queued state changes until closed
+func (n *notifier) run() {
+	for range n.wake {
+		for {
+			n.Lock()
+			queue := n.queue
+			n.queue = nil
+			n.Unlock()
+
+			if len(queue) == 0 {
+				break
+			}
+			for _, change := range queue {
+				n.hook(change.url, change.from, change.to)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package crawlbot
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"net/url"
+	"strings"
+)
+
+// Find the next pages of a paginated listing, from rel=next links in the Link header, <link> tags and <a> tags
+func findNextPages(resp *Response) []string {
+	next := make([]string, 0)
+
+	base, err := url.Parse(resp.URL)
+	if err != nil {
+		return next
+	}
+	add := func(link string) {
+		if resolved, ok := resp.Crawler.ResolveURL(base, link); ok {
+			next = append(next, resolved)
+		}
+	}
+
+	if resp.Response != nil {
+		for _, header := range resp.Header.Values("Link") {
+			for _, link := range parseLinkHeader(header, "next") {
+				add(link)
+			}
+		}
+	}
+
+	if doc := resp.document(); doc != nil {
+		doc.Find("link[rel~='next'], a[rel~='next']").Each(func(i int, s *goquery.Selection) {
+			if link, ok := s.Attr("href"); ok {
+				add(link)
+			}
+		})
+	}
+
+	return next
+}
+
+// Get the targets of the links in a Link header (RFC 8288) with the given relation type
+func parseLinkHeader(header string, rel string) []string {
+	links := make([]string, 0)
+	for {
+		start := strings.Index(header, "<")
+		end := strings.Index(header, ">")
+		if start == -1 || end < start {
+			return links
+		}
+		target := header[start+1 : end]
+		header = header[end+1:]
+
+		// The link's parameters run up to the start of the next link
+		params := header
+		if next := strings.Index(header, "<"); next != -1 {
+			params = header[:next]
+		}
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(name), "rel") {
+				continue
+			}
+			value = strings.Trim(strings.TrimRight(strings.TrimSpace(value), ", "), "\"")
+			for _, r := range strings.Fields(value) {
+				if strings.EqualFold(r, rel) {
+					links = append(links, target)
+				}
+			}
+		}
+	}
+}
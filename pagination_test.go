@@ -0,0 +1,49 @@
+package crawlbot
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected []string
+	}{
+		{`</page/2>; rel="next"`, []string{"/page/2"}},
+		{`</page/1>; rel="prev", </page/3>; rel="next"`, []string{"/page/3"}},
+		{`</page/3>; rel="next last"`, []string{"/page/3"}},
+		{`</page/3>; title="next"; REL=Next`, []string{"/page/3"}},
+		{`</page/1>; rel="prev"`, []string{}},
+		{`garbage`, []string{}},
+	}
+	for _, test := range tests {
+		if links := parseLinkHeader(test.header, "next"); strings.Join(links, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("%q: expected %v, got %v", test.header, test.expected, links)
+		}
+	}
+}
+
+func TestFollowPagination(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/list":   {Header: http.Header{"Link": {`</list/2>; rel="next"`}}, Body: `<a href="/item/1">1</a><a href="/item/2">2</a>`},
+		"http://example.com/list/2": {Body: `<link rel="next" href="/list/3"><a href="/item/3">3</a>`},
+		"http://example.com/list/3": {Body: `<a rel="next" href="/list/4">more</a><a href="/item/4">4</a>`},
+		"http://example.com/list/4": {},
+		"http://example.com/item/1": {},
+		"http://example.com/item/2": {},
+		"http://example.com/item/3": {},
+		"http://example.com/item/4": {},
+	}
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/list"}, NumWorkers: 1, FollowPagination: true, Handler: rec.handle, Client: NewMockClient(pages)}
+	crawl(t, c)
+
+	// The listing pages are crawled before the items found on them
+	order := rec.bySeq()
+	expected := []string{"http://example.com/list", "http://example.com/list/2", "http://example.com/list/3", "http://example.com/list/4"}
+	if len(order) != len(pages) || strings.Join(order[:4], " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected the listing pages to be crawled first, got %v", order)
+	}
+}
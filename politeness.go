@@ -0,0 +1,83 @@
+package crawlbot
+
+import (
+	"time"
+)
+
+// Set the minimum time between requests to a host, overriding CrawlDelay and any Crawl-delay in the host's robots.txt.
+// This may be called while the crawler is running, eg. from a Handler to back off a host that responds with
+// 429 Too Many Requests, and applies from the next request dispatched to the host.
+func (c *Crawler) SetCrawlDelay(host string, delay time.Duration) {
+	c.mux.Lock()
+	if c.hostDelays == nil {
+		c.hostDelays = make(map[string]time.Duration)
+	}
+	c.hostDelays[host] = delay
+	c.mux.Unlock()
+
+	// A shorter delay may let a waiting URL be dispatched sooner
+	c.signal()
+}
+
+// Get the minimum time between requests to a host. A delay set by SetCrawlDelay() overrides a Crawl-delay in the host's
+// robots.txt, which overrides CrawlDelay. Must be called with the mutex held.
+func (c *Crawler) crawlDelay(host string) time.Duration {
+	if delay, ok := c.hostDelays[host]; ok {
+		return delay
+	}
+	if delay, ok := c.robotsDelays[host]; ok {
+		return delay
+	}
+	return c.CrawlDelay
+}
+
+// Check if enough time has passed since the last request to a host was dispatched. Must be called with the mutex held.
+func (c *Crawler) delayPassed(host string) bool {
+	delay := c.crawlDelay(host)
+	if delay <= 0 {
+		return true
+	}
+	return time.Since(c.lastDispatch[host]) >= delay
+}
+
+// Record that a request to the host of a URL was dispatched to a worker. Must be called with the mutex held.
+func (c *Crawler) recordDispatch(w *worker, url string) {
+	if c.lastDispatch == nil {
+		c.lastDispatch = make(map[string]time.Time)
+	}
+	host := hostOf(url)
+	w.prevDispatch = c.lastDispatch[host]
+	w.dispatched = time.Now()
+	c.lastDispatch[host] = w.dispatched
+}
+
+// Undo recording a dispatch to a worker that didn't make a request, unless the host has been dispatched to since.
+// Must be called with the mutex held.
+func (c *Crawler) undoDispatch(w *worker, url string) {
+	host := hostOf(url)
+	if !c.lastDispatch[host].Equal(w.dispatched) {
+		return
+	}
+	if w.prevDispatch.IsZero() {
+		delete(c.lastDispatch, host)
+	} else {
+		c.lastDispatch[host] = w.prevDispatch
+	}
+}
+
+// Get how long to wait before checking again for pending URLs that can't be dispatched yet because of a crawl delay
+// or the schedule, or 0 if there are none. Must be called with the mutex held.
+func (c *Crawler) nextDispatch() time.Duration {
+	if !c.Schedule.allows(time.Now()) {
+		return time.Second
+	}
+
+	var wait time.Duration
+	for host, last := range c.lastDispatch {
+		delay := c.crawlDelay(host) - time.Since(last)
+		if delay > 0 && (wait == 0 || delay < wait) {
+			wait = delay
+		}
+	}
+	return wait
+}
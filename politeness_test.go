@@ -0,0 +1,32 @@
+package crawlbot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetCrawlDelay(t *testing.T) {
+	pages := map[string]MockResponse{"http://example.com/": {Body: `<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a>`}}
+	for _, page := range []string{"1", "2", "3"} {
+		pages["http://example.com/"+page] = MockResponse{}
+	}
+	transport := newTestTransport(pages)
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 4, CrawlDelay: time.Hour, Client: transport.client}
+	c.SetCrawlDelay("example.com", time.Millisecond)
+	c.Handler = func(resp *Response) {
+		// Back off after the first page
+		if resp.URL == "http://example.com/" {
+			c.SetCrawlDelay("example.com", 30*time.Millisecond)
+		}
+	}
+	crawl(t, c)
+
+	if len(transport.times) != 4 {
+		t.Fatalf("Expected 4 requests, got %d", len(transport.times))
+	}
+	for i := 1; i < len(transport.times); i++ {
+		if gap := transport.times[i].Sub(transport.times[i-1]); gap < 25*time.Millisecond {
+			t.Errorf("Expected requests to be at least the new delay apart, request %d followed after %s", i, gap)
+		}
+	}
+}
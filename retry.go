@@ -0,0 +1,125 @@
+package crawlbot
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// The kind of error a request failed with, used by RetryPolicy to decide whether to retry and by Stats to count errors
+type ErrKind int
+
+const (
+	// The request did not fail
+	ErrKindNone ErrKind = iota
+
+	// The host name could not be resolved
+	ErrKindDNS ErrKind = iota
+
+	// The request timed out
+	ErrKindTimeout ErrKind = iota
+
+	// The connection could not be made or was broken
+	ErrKindConnection ErrKind = iota
+
+	// The server responded with 429 Too Many Requests
+	ErrKindTooManyRequests ErrKind = iota
+
+	// The server responded with a 5xx status
+	ErrKindServer ErrKind = iota
+
+	// The request failed in a way that retrying won't fix, such as a redirect back to the same URL. Never retried.
+	ErrKindOther ErrKind = iota
+)
+
+func (k ErrKind) String() string {
+	switch k {
+	case ErrKindNone:
+		return "none"
+	case ErrKindDNS:
+		return "dns"
+	case ErrKindTimeout:
+		return "timeout"
+	case ErrKindConnection:
+		return "connection"
+	case ErrKindTooManyRequests:
+		return "too many requests"
+	case ErrKindServer:
+		return "server"
+	case ErrKindOther:
+		return "other"
+	}
+	return "unknown"
+}
+
+// Classify the outcome of an HTTP request
+func classifyErr(httpresp *http.Response, err error) ErrKind {
+	if err != nil {
+		// http.Client wraps every error in a *url.Error, which is itself a net.Error, so look at what it wraps
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		kind := ErrKindOther
+		for e := err; e != nil; {
+			if dnsErr, ok := e.(*net.DNSError); ok && !dnsErr.IsTimeout {
+				return ErrKindDNS
+			}
+			if netErr, ok := e.(net.Error); ok {
+				if netErr.Timeout() {
+					return ErrKindTimeout
+				}
+				kind = ErrKindConnection
+			}
+			if e == io.EOF || e == io.ErrUnexpectedEOF {
+				kind = ErrKindConnection
+			}
+			wrapper, ok := e.(interface{ Unwrap() error })
+			if !ok {
+				break
+			}
+			e = wrapper.Unwrap()
+		}
+		return kind
+	}
+	if httpresp.StatusCode == http.StatusTooManyRequests {
+		return ErrKindTooManyRequests
+	}
+	if httpresp.StatusCode >= 500 {
+		return ErrKindServer
+	}
+	return ErrKindNone
+}
+
+// Do an HTTP request, retrying it for as long as RetryPolicy allows
+func (w *worker) doWithRetry(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		httpresp, err := w.do(req)
+		if w.crawler.RetryPolicy == nil {
+			return httpresp, err
+		}
+		// Once the request's context is done there is no point retrying
+		kind := classifyErr(httpresp, err)
+		if kind == ErrKindNone || kind == ErrKindOther || req.Context().Err() != nil {
+			return httpresp, err
+		}
+		retry, delay := w.crawler.RetryPolicy(kind, attempt)
+		if !retry {
+			return httpresp, err
+		}
+		if httpresp != nil {
+			httpresp.Body.Close()
+		}
+
+		// Give up the request slot while waiting so other workers can use it
+		w.releaseRequest()
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			w.acquireRequest()
+			return nil, req.Context().Err()
+		}
+		w.acquireRequest()
+	}
+}
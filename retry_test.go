@@ -0,0 +1,151 @@
+package crawlbot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A net.Error that times out
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestClassifyErr(t *testing.T) {
+	wrap := func(err error) error {
+		return &url.Error{Op: "Get", URL: "http://example.com/", Err: err}
+	}
+	tests := []struct {
+		status int
+		err    error
+		kind   ErrKind
+	}{
+		{200, nil, ErrKindNone},
+		{404, nil, ErrKindNone},
+		{429, nil, ErrKindTooManyRequests},
+		{503, nil, ErrKindServer},
+		{0, wrap(&net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}), ErrKindDNS},
+		{0, wrap(&net.DNSError{Err: "timeout", Name: "example.com", IsTimeout: true}), ErrKindTimeout},
+		{0, wrap(timeoutErr{}), ErrKindTimeout},
+		{0, wrap(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), ErrKindConnection},
+		{0, wrap(io.ErrUnexpectedEOF), ErrKindConnection},
+		{0, wrap(ErrSelfRedirect), ErrKindOther},
+		{0, errors.New("unsupported protocol scheme"), ErrKindOther},
+	}
+	for _, test := range tests {
+		var httpresp *http.Response
+		if test.err == nil {
+			httpresp = &http.Response{StatusCode: test.status}
+		}
+		if kind := classifyErr(httpresp, test.err); kind != test.kind {
+			t.Errorf("%d %v: expected %v, got %v", test.status, test.err, test.kind, kind)
+		}
+	}
+}
+
+// A RoundTripper that fails every request with an error
+type failingTransport struct {
+	err error
+
+	mux      sync.Mutex
+	attempts int
+}
+
+func (t *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mux.Lock()
+	t.attempts++
+	t.mux.Unlock()
+	return nil, t.err
+}
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		err      error
+		attempts int
+	}{
+		{timeoutErr{}, 3},
+		{&net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}, 1},
+		{errors.New("malformed response"), 1},
+	}
+	for _, test := range tests {
+		transport := &failingTransport{err: test.err}
+		var mux sync.Mutex
+		kinds := make([]ErrKind, 0)
+		rec := newRecorder()
+		c := &Crawler{
+			URLs:       []string{"http://example.com/"},
+			NumWorkers: 1,
+			Handler:    rec.handle,
+			Client:     func() *http.Client { return &http.Client{Transport: transport} },
+			RetryPolicy: func(errKind ErrKind, attempt int) (bool, time.Duration) {
+				mux.Lock()
+				defer mux.Unlock()
+				kinds = append(kinds, errKind)
+				return errKind == ErrKindTimeout && attempt < 3, time.Millisecond
+			},
+		}
+		crawl(t, c)
+
+		if transport.attempts != test.attempts {
+			t.Errorf("%v: expected %d attempts, got %d", test.err, test.attempts, transport.attempts)
+		}
+		if resp := rec.get("http://example.com/"); resp == nil || !isErr(resp.Err, ErrReqFailed) {
+			t.Errorf("%v: expected the final failure to be reported, got %v", test.err, resp)
+		}
+		if _, other := test.err.(net.Error); !other && len(kinds) != 0 {
+			t.Errorf("%v: expected RetryPolicy not to be consulted for an error retrying won't fix, got %v", test.err, kinds)
+		}
+	}
+}
+
+func TestRetryServerErrors(t *testing.T) {
+	pages := map[string]MockResponse{"http://example.com/": {StatusCode: http.StatusServiceUnavailable}}
+	transport := newTestTransport(pages)
+	c := &Crawler{
+		URLs:        []string{"http://example.com/"},
+		NumWorkers:  1,
+		Handler:     func(resp *Response) {},
+		Client:      transport.client,
+		RetryPolicy: func(errKind ErrKind, attempt int) (bool, time.Duration) { return attempt < 4, time.Millisecond },
+	}
+	crawl(t, c)
+
+	if n := transport.count("http://example.com/"); n != 4 {
+		t.Errorf("Expected a 503 to be retried until RetryPolicy gives up, got %d requests", n)
+	}
+	if byKind := c.Stats().ErrorsByKind; byKind[ErrKindServer] != 1 {
+		t.Errorf("Expected the rejected 503 to be counted once as a server error, got %v", byKind)
+	}
+}
+
+func TestRetryStopsOnCancel(t *testing.T) {
+	transport := &failingTransport{err: timeoutErr{}}
+	c := &Crawler{
+		URLs:        []string{"http://example.com/"},
+		NumWorkers:  1,
+		Handler:     func(resp *Response) {},
+		Client:      func() *http.Client { return &http.Client{Transport: transport} },
+		RetryPolicy: func(errKind ErrKind, attempt int) (bool, time.Duration) { return true, time.Hour },
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.StartContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, c)
+
+	if transport.attempts != 1 {
+		t.Errorf("Expected the retry delay to be cut short by cancellation, got %d attempts", transport.attempts)
+	}
+	if state := c.State("http://example.com/"); state != StatePending {
+		t.Errorf("Expected the cancelled URL to be left pending, got %v", state)
+	}
+}
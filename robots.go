@@ -0,0 +1,37 @@
+package crawlbot
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Parse the X-Robots-Tag headers of a response.
+// Directives scoped to a specific user-agent (eg. "googlebot: noindex") are ignored.
+func parseRobotsTag(header http.Header) (noindex bool, nofollow bool) {
+	for _, value := range header["X-Robots-Tag"] {
+		if i := strings.Index(value, ":"); i != -1 && !strings.Contains(value[:i], ",") && !isRobotsDirective(value[:i]) {
+			continue
+		}
+		for _, directive := range strings.Split(value, ",") {
+			switch strings.ToLower(strings.TrimSpace(directive)) {
+			case "noindex":
+				noindex = true
+			case "nofollow":
+				nofollow = true
+			case "none":
+				noindex = true
+				nofollow = true
+			}
+		}
+	}
+	return noindex, nofollow
+}
+
+// Check if the text before a colon in an X-Robots-Tag is a directive (eg. "unavailable_after: ...") rather than a user-agent
+func isRobotsDirective(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "unavailable_after", "max-snippet", "max-image-preview", "max-video-preview":
+		return true
+	}
+	return false
+}
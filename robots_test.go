@@ -0,0 +1,50 @@
+package crawlbot
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseRobotsTag(t *testing.T) {
+	tests := []struct {
+		values   []string
+		noindex  bool
+		nofollow bool
+	}{
+		{nil, false, false},
+		{[]string{"noindex"}, true, false},
+		{[]string{"NoFollow"}, false, true},
+		{[]string{"noindex, nofollow"}, true, true},
+		{[]string{"none"}, true, true},
+		{[]string{"noarchive", "nofollow"}, false, true},
+		{[]string{"googlebot: noindex"}, false, false},
+		{[]string{"unavailable_after: 25 Jun 2030 15:00:00 PST, noindex"}, true, false},
+	}
+	for _, test := range tests {
+		noindex, nofollow := parseRobotsTag(http.Header{"X-Robots-Tag": test.values})
+		if noindex != test.noindex || nofollow != test.nofollow {
+			t.Errorf("%q: expected %v %v, got %v %v", test.values, test.noindex, test.nofollow, noindex, nofollow)
+		}
+	}
+}
+
+func TestRobotsTag(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/":  {Header: http.Header{"X-Robots-Tag": {"noindex"}}, Body: `<a href="/a">a</a>`},
+		"http://example.com/a": {Header: http.Header{"X-Robots-Tag": {"nofollow"}}, Body: `<a href="/b">b</a>`},
+		"http://example.com/b": {},
+	}
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 1, RespectRobots: true, Handler: rec.handle, Client: NewMockClient(pages)}
+	crawl(t, c)
+
+	if rec.get("http://example.com/") != nil {
+		t.Error("Expected a noindex page not to be passed to the Handler")
+	}
+	if rec.get("http://example.com/a") == nil {
+		t.Error("Expected links on a noindex page to be followed")
+	}
+	if state := c.State("http://example.com/b"); state != StateNotFound {
+		t.Errorf("Expected links on a nofollow page not to be followed, got %v", state)
+	}
+}
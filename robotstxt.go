@@ -0,0 +1,244 @@
+package crawlbot
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The maximum number of bytes of a robots.txt file that are parsed
+const robotsMaxSize = 500 * 1024
+
+// The rules in a robots.txt file that apply to the crawler's user-agent
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration // The Crawl-delay for the user-agent, or 0 if there is none
+}
+
+// An Allow or Disallow rule
+type robotsRule struct {
+	allow   bool
+	line    string         // The rule as written in robots.txt, for reporting
+	length  int            // The length of the path pattern. The longest matching pattern wins.
+	pattern *regexp.Regexp // The path pattern, with * matching anything and $ anchoring the end
+}
+
+// A cached robots.txt for a host. ready is closed once rules is set.
+type robotsEntry struct {
+	ready chan bool
+	rules *robotsRules
+}
+
+// Rules that allow everything, used when a host has no robots.txt
+var robotsAllowAll = &robotsRules{}
+
+// Rules that disallow everything, used when a host's robots.txt can't be fetched because of a server error
+var robotsDisallowAll = &robotsRules{rules: []robotsRule{{line: "robots.txt unavailable", pattern: regexp.MustCompile("^")}}}
+
+// Check if a URL may be crawled according to the robots.txt of its host, fetching and caching the robots.txt the first
+// time the host is seen. If the URL is disallowed the rule that disallowed it is returned, along with the robots.txt
+// it came from, eg. "Disallow: /private in http://example.com/robots.txt".
+func (w *worker) robotsAllowed(rawurl string) (allowed bool, rule string) {
+	parsed, err := url.Parse(rawurl)
+	if err != nil {
+		return true, ""
+	}
+	robotsURL := parsed.Scheme + "://" + parsed.Host + "/robots.txt"
+
+	// The first worker to see a host fetches its robots.txt, and any others wait for it
+	c := w.crawler
+	c.mux.Lock()
+	if c.robots == nil {
+		c.robots = make(map[string]*robotsEntry)
+	}
+	entry, ok := c.robots[robotsURL]
+	if !ok {
+		entry = &robotsEntry{ready: make(chan bool)}
+		c.robots[robotsURL] = entry
+	}
+	c.mux.Unlock()
+
+	if !ok {
+		entry.rules = w.fetchRobots(robotsURL)
+		close(entry.ready)
+
+		// Don't keep rules from a fetch that failed because the crawl was cancelled
+		if c.ctx.Err() != nil {
+			c.mux.Lock()
+			delete(c.robots, robotsURL)
+			c.mux.Unlock()
+		}
+		if entry.rules.crawlDelay > 0 {
+			c.mux.Lock()
+			if c.robotsDelays == nil {
+				c.robotsDelays = make(map[string]time.Duration)
+			}
+			c.robotsDelays[parsed.Host] = entry.rules.crawlDelay
+			c.mux.Unlock()
+		}
+	}
+	<-entry.ready
+	allowed, rule = entry.rules.allowed(parsed.RequestURI())
+	if !allowed {
+		rule += " in " + robotsURL
+	}
+	return allowed, rule
+}
+
+// Fetch and parse a robots.txt with the worker's client.
+// A missing robots.txt allows everything, and one that can't be fetched because of a server or network error disallows everything.
+func (w *worker) fetchRobots(robotsURL string) *robotsRules {
+	req, err := http.NewRequestWithContext(w.crawler.ctx, "GET", robotsURL, nil)
+	if err != nil {
+		return robotsAllowAll
+	}
+	w.setHeaders(req)
+
+	// Fetching robots.txt counts towards MaxConcurrentRequests like any other request
+	w.acquireRequest()
+	defer w.releaseRequest()
+
+	resp, err := w.clientFor(req.URL.Scheme).Do(req)
+	if err != nil {
+		return robotsDisallowAll
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return robotsDisallowAll
+	case resp.StatusCode >= 400:
+		return robotsAllowAll
+	case resp.StatusCode >= 300:
+		// Redirects the client did not follow
+		return robotsAllowAll
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, robotsMaxSize))
+	if err != nil {
+		return robotsDisallowAll
+	}
+	return parseRobots(body, w.crawler.UserAgent)
+}
+
+// Parse a robots.txt file, keeping only the rules for the group that best matches the user-agent.
+// A group matches if its user-agent appears in ours, case-insensitively. The longest matching user-agent wins,
+// and the * group is used if no other group matches.
+func parseRobots(body []byte, userAgent string) *robotsRules {
+	userAgent = strings.ToLower(userAgent)
+
+	type group struct {
+		agents []string
+		rules  robotsRules
+	}
+	groups := make([]*group, 0)
+	var current *group
+	inAgents := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			if !inAgents {
+				current = &group{}
+				groups = append(groups, current)
+				inAgents = true
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inAgents = false
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules.rules = append(current.rules.rules, robotsRule{
+				allow:   field == "allow",
+				line:    strings.TrimSpace(line),
+				length:  len(value),
+				pattern: robotsPattern(value),
+			})
+		case "crawl-delay":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+				current.rules.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	// Merge the rules of every group for the best matching user-agent
+	best, bestLen := "", -1
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			if agent == "*" && bestLen < 0 {
+				best, bestLen = agent, 0
+			} else if agent != "*" && agent != "" && strings.Contains(userAgent, agent) && len(agent) > bestLen {
+				best, bestLen = agent, len(agent)
+			}
+		}
+	}
+	rules := &robotsRules{}
+	if bestLen < 0 {
+		return rules
+	}
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			if agent == best {
+				rules.rules = append(rules.rules, g.rules.rules...)
+				if g.rules.crawlDelay > rules.crawlDelay {
+					rules.crawlDelay = g.rules.crawlDelay
+				}
+				break
+			}
+		}
+	}
+	return rules
+}
+
+// Compile a robots.txt path pattern
+func robotsPattern(path string) *regexp.Regexp {
+	anchored := strings.HasSuffix(path, "$")
+	path = strings.TrimSuffix(path, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(path), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// Check if a path may be crawled. The longest matching rule wins, and Allow wins a tie.
+// If the path is disallowed the rule that disallowed it is returned.
+func (r *robotsRules) allowed(path string) (bool, string) {
+	var match *robotsRule
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if match == nil || rule.length > match.length || (rule.length == match.length && rule.allow) {
+			match = rule
+		}
+	}
+	if match == nil || match.allow {
+		return true, ""
+	}
+	return false, match.line
+}
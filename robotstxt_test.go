@@ -0,0 +1,164 @@
+package crawlbot
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	body := []byte(`# Comment
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Crawl-delay: 2
+
+User-agent: testbot
+User-agent: otherbot
+Disallow: /tmp/   # trailing comment
+Disallow: /*.pdf$
+Allow: /tmp/ok
+Crawl-delay: 0.5
+`)
+	tests := []struct {
+		userAgent string
+		path      string
+		allowed   bool
+		rule      string
+	}{
+		{"somebot/1.0", "/", true, ""},
+		{"somebot/1.0", "/private/page", false, "Disallow: /private"},
+		{"somebot/1.0", "/private/public/page", true, ""},
+		{"TestBot/2.0", "/private/page", true, ""},
+		{"TestBot/2.0", "/tmp/file", false, "Disallow: /tmp/"},
+		{"TestBot/2.0", "/tmp/ok", true, ""},
+		{"TestBot/2.0", "/docs/file.pdf", false, "Disallow: /*.pdf$"},
+		{"TestBot/2.0", "/docs/file.pdf?download=1", true, ""},
+	}
+	for _, test := range tests {
+		rules := parseRobots(body, test.userAgent)
+		allowed, rule := rules.allowed(test.path)
+		if allowed != test.allowed || rule != test.rule {
+			t.Errorf("%s %s: expected %v %q, got %v %q", test.userAgent, test.path, test.allowed, test.rule, allowed, rule)
+		}
+	}
+
+	if delay := parseRobots(body, "somebot").crawlDelay; delay != 2*time.Second {
+		t.Errorf("Expected a Crawl-delay of 2s, got %s", delay)
+	}
+	if delay := parseRobots(body, "testbot").crawlDelay; delay != 500*time.Millisecond {
+		t.Errorf("Expected a Crawl-delay of 500ms, got %s", delay)
+	}
+	if rules := parseRobots([]byte("User-agent: otherbot\nDisallow: /\n"), "testbot"); len(rules.rules) != 0 {
+		t.Errorf("Expected no rules when no group matches, got %v", rules.rules)
+	}
+}
+
+func TestRespectRobots(t *testing.T) {
+	pages := map[string]MockResponse{"http://example.com/robots.txt": {Header: http.Header{"Content-Type": {"text/plain"}}, Body: "User-agent: *\nDisallow: /b\n"}}
+	for url, page := range testSite {
+		pages[url] = page
+	}
+	transport := newTestTransport(pages)
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 2, RespectRobots: true, Handler: rec.handle, Client: transport.client}
+	crawl(t, c)
+
+	resp := rec.get("http://example.com/b")
+	if resp == nil || !isErr(resp.Err, ErrRobotsDisallowed) || !strings.Contains(resp.Err.Error(), "Disallow: /b") {
+		t.Errorf("Expected the disallowed URL to be reported with the rule that disallowed it, got %v", resp)
+	}
+	if n := transport.count("http://example.com/b"); n != 0 {
+		t.Errorf("Expected the disallowed URL not to be fetched, got %d requests", n)
+	}
+	if n := transport.count("http://example.com/robots.txt"); n != 1 {
+		t.Errorf("Expected robots.txt to be fetched once, got %d requests", n)
+	}
+	if state := c.State("http://example.com/b"); state != StateRejected {
+		t.Errorf("Expected the disallowed URL to be rejected, got %v", state)
+	}
+	if requests := c.Stats().Requests; requests != 3 {
+		t.Errorf("Expected only the 3 fetched URLs to be counted as requests, got %d", requests)
+	}
+}
+
+func TestRobotsMaxConcurrentRequests(t *testing.T) {
+	pages := map[string]MockResponse{}
+	urls := make([]string, 0)
+	for _, host := range []string{"h1", "h2", "h3", "h4"} {
+		pages["http://"+host+".com/robots.txt"] = MockResponse{Header: http.Header{"Content-Type": {"text/plain"}}, Body: "User-agent: *\nAllow: /\n"}
+		pages["http://"+host+".com/"] = MockResponse{}
+		urls = append(urls, "http://"+host+".com/")
+	}
+	transport := newTestTransport(pages)
+	transport.delay = 10 * time.Millisecond
+	c := &Crawler{URLs: urls, NumWorkers: 4, MaxConcurrentRequests: 1, RespectRobots: true, Handler: func(resp *Response) {}, Client: transport.client}
+	crawl(t, c)
+
+	if n := transport.total(); n != 8 {
+		t.Errorf("Expected 8 requests, got %d", n)
+	}
+	if transport.peak > 1 {
+		t.Errorf("%d requests were in flight at once, expected robots.txt requests to respect MaxConcurrentRequests", transport.peak)
+	}
+}
+
+func TestRobotsDecision(t *testing.T) {
+	robots := "User-agent: *\nDisallow: /private\nAllow: /private/ok\nDisallow: /*.pdf$\n"
+	pages := map[string]MockResponse{
+		"http://example.com/":           {Body: `<a href="/private/a">a</a><a href="/private/ok">ok</a><a href="/doc.pdf">pdf</a>`},
+		"http://example.com/robots.txt": {Header: http.Header{"Content-Type": {"text/plain"}}, Body: robots},
+		"http://example.com/private/ok": {},
+	}
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 2, RespectRobots: true, Handler: rec.handle, Client: NewMockClient(pages)}
+	crawl(t, c)
+
+	tests := map[string]string{
+		"http://example.com/private/a": "Disallow: /private in http://example.com/robots.txt",
+		"http://example.com/doc.pdf":   "Disallow: /*.pdf$ in http://example.com/robots.txt",
+	}
+	for url, rule := range tests {
+		if resp := rec.get(url); resp == nil || !isErr(resp.Err, ErrRobotsDisallowed) || !strings.Contains(resp.Err.Error(), rule) {
+			t.Errorf("Expected %s to be reported as disallowed by %q, got %v", url, rule, resp)
+		}
+	}
+	if resp := rec.get("http://example.com/private/ok"); resp == nil || resp.Err != nil {
+		t.Errorf("Expected the allowed URL to be crawled, got %v", resp)
+	}
+}
+
+func TestCrawlDelay(t *testing.T) {
+	for _, fromRobots := range []bool{false, true} {
+		pages := map[string]MockResponse{"http://example.com/robots.txt": {StatusCode: http.StatusNotFound}}
+		for url, page := range testSite {
+			pages[url] = page
+		}
+		c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 4, Handler: func(resp *Response) {}}
+		if fromRobots {
+			pages["http://example.com/robots.txt"] = MockResponse{Header: http.Header{"Content-Type": {"text/plain"}}, Body: "User-agent: *\nCrawl-delay: 0.03\n"}
+			c.RespectRobots = true
+			c.CrawlDelay = time.Millisecond
+		} else {
+			c.CrawlDelay = 30 * time.Millisecond
+		}
+		transport := newTestTransport(pages)
+		c.Client = transport.client
+		crawl(t, c)
+
+		times := transport.times
+		if fromRobots {
+			// Skip the robots.txt request
+			times = times[1:]
+		}
+		if len(times) != len(testSite) {
+			t.Fatalf("Expected %d requests, got %d", len(testSite), len(times))
+		}
+		for i := 1; i < len(times); i++ {
+			if gap := times[i].Sub(times[i-1]); gap < 25*time.Millisecond {
+				t.Errorf("Crawl-delay from robots.txt %v: request %d followed after %s", fromRobots, i, gap)
+			}
+		}
+	}
+}
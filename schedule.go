@@ -0,0 +1,63 @@
+package crawlbot
+
+import (
+	"time"
+)
+
+// The times at which the crawler may make requests. A Schedule with no windows allows requests at any time.
+type Schedule struct {
+	// The windows during which requests may be made
+	Windows []TimeWindow
+
+	// The time zone the windows are in. If nil the local time zone is used.
+	Location *time.Location
+}
+
+// A daily window of time, eg. from 22:00 to 06:00 for off-peak hours
+type TimeWindow struct {
+	// The start and end of the window as offsets from midnight, eg. 22 * time.Hour.
+	// If End is before Start the window runs past midnight into the next day.
+	Start time.Duration
+	End   time.Duration
+
+	// The days on which the window starts. If empty the window applies every day.
+	Days []time.Weekday
+}
+
+// Check if the schedule allows requests at time t
+func (s Schedule) allows(t time.Time) bool {
+	if len(s.Windows) == 0 {
+		return true
+	}
+	if s.Location != nil {
+		t = t.In(s.Location)
+	}
+
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+	for _, w := range s.Windows {
+		if w.Start <= w.End {
+			if w.on(today) && offset >= w.Start && offset < w.End {
+				return true
+			}
+		} else if (w.on(today) && offset >= w.Start) || (w.on(yesterday) && offset < w.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if a window starts on a day
+func (w TimeWindow) on(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
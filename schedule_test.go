@@ -0,0 +1,68 @@
+package crawlbot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleAllows(t *testing.T) {
+	office := Schedule{Windows: []TimeWindow{{Start: 9 * time.Hour, End: 17 * time.Hour, Days: []time.Weekday{time.Monday, time.Tuesday}}}}
+	overnight := Schedule{Windows: []TimeWindow{{Start: 22 * time.Hour, End: 6 * time.Hour, Days: []time.Weekday{time.Friday}}}}
+	at := func(day, hour, minute int) time.Time {
+		// 2024-01-01 was a Monday
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		schedule Schedule
+		t        time.Time
+		allowed  bool
+	}{
+		{Schedule{}, at(1, 3, 0), true},
+		{office, at(1, 9, 0), true},
+		{office, at(2, 16, 59), true},
+		{office, at(1, 17, 0), false},
+		{office, at(1, 8, 59), false},
+		{office, at(3, 12, 0), false},
+		{overnight, at(5, 23, 0), true},
+		{overnight, at(6, 5, 59), true},
+		{overnight, at(6, 23, 0), false},
+		{overnight, at(5, 5, 0), false},
+		{overnight, at(5, 12, 0), false},
+	}
+	for _, test := range tests {
+		if allowed := test.schedule.allows(test.t); allowed != test.allowed {
+			t.Errorf("%+v at %s: expected %v, got %v", test.schedule.Windows, test.t.Format(time.RFC1123), test.allowed, allowed)
+		}
+	}
+
+	// Times are converted to the schedule's time zone
+	zoned := office
+	zoned.Location = time.FixedZone("UTC+10", 10*60*60)
+	if !zoned.allows(at(1, 0, 0)) || zoned.allows(at(1, 9, 0)) {
+		t.Error("Expected the schedule to apply in its time zone")
+	}
+}
+
+func TestScheduleDelaysCrawl(t *testing.T) {
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := (now.Add(300 * time.Millisecond).Sub(midnight)) % (24 * time.Hour)
+	window := TimeWindow{Start: start, End: (start + time.Hour) % (24 * time.Hour)}
+
+	transport := newTestTransport(testSite)
+	c := &Crawler{
+		URLs:       []string{"http://example.com/c"},
+		NumWorkers: 1,
+		Schedule:   Schedule{Windows: []TimeWindow{window}, Location: time.UTC},
+		Handler:    func(resp *Response) {},
+		Client:     transport.client,
+	}
+	crawl(t, c)
+
+	if len(transport.times) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(transport.times))
+	}
+	if transport.times[0].Before(now.Add(300 * time.Millisecond)) {
+		t.Errorf("Expected no requests before the window opened, got one %s early", now.Add(300*time.Millisecond).Sub(transport.times[0]))
+	}
+}
@@ -0,0 +1,82 @@
+package crawlbot
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// A seenSet remembers URLs that have been evicted from the frontier, for deduplication.
+type seenSet interface {
+	add(url string)
+	has(url string) bool
+}
+
+// A hashSet is a seenSet that stores a 64-bit hash of each URL.
+// A hash collision can cause a never-seen URL to be reported as seen, but this is vanishingly unlikely.
+type hashSet map[uint64]bool
+
+func (s hashSet) add(url string) {
+	s[hashURL(url)] = true
+}
+
+func (s hashSet) has(url string) bool {
+	return s[hashURL(url)]
+}
+
+// A bloomFilter is a seenSet that uses a fixed amount of memory regardless of the number of URLs,
+// at the cost of a tunable rate of never-seen URLs being reported as seen.
+type bloomFilter struct {
+	bits []uint64 // The bit array
+	m    uint64   // Number of bits
+	k    uint64   // Number of hash functions
+}
+
+// Create a bloom filter sized for n URLs with a false positive rate of p
+func newBloomFilter(n int, p float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m == 0 {
+		m = 1
+	}
+	k := uint64(math.Ceil(float64(m) / float64(n) * math.Ln2))
+	if k == 0 {
+		k = 1
+	}
+	return &bloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// Get the bit positions for a URL, using double hashing to derive k hashes from one 64-bit hash
+func (b *bloomFilter) positions(url string) []uint64 {
+	h := hashURL(url)
+	h1, h2 := h&0xffffffff, h>>32
+	positions := make([]uint64, b.k)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % b.m
+	}
+	return positions
+}
+
+func (b *bloomFilter) add(url string) {
+	for _, pos := range b.positions(url) {
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (b *bloomFilter) has(url string) bool {
+	for _, pos := range b.positions(url) {
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Hash a URL for compact storage
+func hashURL(url string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(url))
+	return h.Sum64()
+}
@@ -0,0 +1,56 @@
+package crawlbot
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Write the state of every URL known to the crawler to w.
+// The state is written as a JSON object mapping each URL to its State.
+// Returns ErrCompactedState if CompactCompleted or BloomDedup is set, since evicted URLs would be missing from the
+// state and a resumed crawl would fetch them again.
+func (c *Crawler) SaveState(w io.Writer) error {
+	if c.CompactCompleted || c.BloomDedup {
+		return ErrCompactedState
+	}
+	return json.NewEncoder(w).Encode(c.frontier().snapshot())
+}
+
+// Load the state of URLs written by SaveState() or passed to Checkpoint, to resume a previous crawl.
+// See AddWithState() for how the states are applied.
+func (c *Crawler) LoadState(r io.Reader) error {
+	var entries map[string]State
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return err
+	}
+	c.AddWithState(entries)
+	return nil
+}
+
+// Add URLs with their states from a previous crawl, so that a resumed crawl skips URLs that are already done and
+// only crawls what was still pending. URLs that were running when the state was saved are made pending again.
+// URLs already known to the crawler are changed to the given state, unless they are currently running.
+// AddWithState may be called before the crawler is started.
+func (c *Crawler) AddWithState(entries map[string]State) {
+	c.frontier().restore(entries)
+}
+
+// Call Checkpoint every CheckpointInterval until finished is closed
+func (c *Crawler) checkpoint(finished chan bool) {
+	ticker := time.NewTicker(c.CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+			state, err := json.Marshal(c.urlstate.snapshot())
+			if err != nil {
+				continue
+			}
+			c.Checkpoint(state)
+		}
+	}
+}
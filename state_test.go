@@ -0,0 +1,159 @@
+package crawlbot
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	transport := newTestTransport(testSite)
+	transport.delay = 20 * time.Millisecond
+	var mux sync.Mutex
+	checkpoints := make([]map[string]State, 0)
+	c := &Crawler{
+		URLs:               []string{"http://example.com/"},
+		NumWorkers:         1,
+		Handler:            func(resp *Response) {},
+		Client:             transport.client,
+		CheckpointInterval: 10 * time.Millisecond,
+		Checkpoint: func(state []byte) {
+			var entries map[string]State
+			if err := json.Unmarshal(state, &entries); err != nil {
+				t.Errorf("Checkpoint passed invalid state: %v", err)
+			}
+			mux.Lock()
+			checkpoints = append(checkpoints, entries)
+			mux.Unlock()
+		},
+	}
+	crawl(t, c)
+
+	mux.Lock()
+	defer mux.Unlock()
+	if len(checkpoints) == 0 {
+		t.Fatal("Expected Checkpoint to be called during the crawl")
+	}
+	if state := checkpoints[0]["http://example.com/"]; state != StateRunning && state != StateDone {
+		t.Errorf("Expected the first checkpoint to include the seed, got %v", checkpoints[0])
+	}
+}
+
+func TestResumeState(t *testing.T) {
+	transport := newTestTransport(testSite)
+	first := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 1, Budget: Budget{MaxPages: 2}, Handler: func(resp *Response) {}, Client: transport.client}
+	crawl(t, first)
+	if reason := first.StopReason(); reason != ErrBudgetPages {
+		t.Fatalf("Expected the first crawl to stop at its page budget, got %v", reason)
+	}
+
+	var saved bytes.Buffer
+	if err := first.SaveState(&saved); err != nil {
+		t.Fatal(err)
+	}
+
+	second := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 1, Handler: func(resp *Response) {}, Client: transport.client}
+	if err := second.LoadState(&saved); err != nil {
+		t.Fatal(err)
+	}
+	crawl(t, second)
+
+	for url := range testSite {
+		if n := transport.count(url); n != 1 {
+			t.Errorf("Expected %s to be fetched once across both crawls, got %d", url, n)
+		}
+		if state := second.State(url); state != StateDone {
+			t.Errorf("Expected %s to be done after resuming, got %v", url, state)
+		}
+	}
+}
+
+func TestAddWithState(t *testing.T) {
+	transport := newTestTransport(testSite)
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 1, Handler: func(resp *Response) {}, Client: transport.client}
+	c.AddWithState(map[string]State{
+		"http://example.com/":  StateDone,
+		"http://example.com/a": StateRunning,
+		"http://example.com/b": StateRejected,
+	})
+	crawl(t, c)
+
+	expected := map[string]int{"http://example.com/": 0, "http://example.com/a": 1, "http://example.com/b": 0, "http://example.com/c": 1}
+	for url, n := range expected {
+		if got := transport.count(url); got != n {
+			t.Errorf("Expected %s to be fetched %d times, got %d", url, n, got)
+		}
+	}
+}
+
+func TestSaveStateCompacted(t *testing.T) {
+	for _, bloom := range []bool{false, true} {
+		c := &Crawler{
+			URLs:             []string{"http://example.com/"},
+			NumWorkers:       1,
+			CompactCompleted: !bloom,
+			BloomDedup:       bloom,
+			Handler:          func(resp *Response) {},
+			Client:           NewMockClient(testSite),
+		}
+		crawl(t, c)
+
+		var saved bytes.Buffer
+		if err := c.SaveState(&saved); err != ErrCompactedState {
+			t.Errorf("BloomDedup %v: expected ErrCompactedState, got %v", bloom, err)
+		}
+	}
+}
+
+func TestCheckpointCompacted(t *testing.T) {
+	c := &Crawler{
+		URLs:               []string{"http://example.com/"},
+		NumWorkers:         1,
+		CompactCompleted:   true,
+		Handler:            func(resp *Response) {},
+		Client:             NewMockClient(testSite),
+		CheckpointInterval: 10 * time.Millisecond,
+		Checkpoint:         func(state []byte) {},
+	}
+	if err := c.Start(); err != ErrCompactedState {
+		t.Fatalf("Expected ErrCompactedState, got %v", err)
+	}
+	if c.IsRunning() {
+		t.Error("Expected the crawler not to be started")
+	}
+}
+
+func TestAddWithStateReleasesWaiters(t *testing.T) {
+	release := make(chan bool)
+	c := &Crawler{
+		URLs:       []string{holdURL, "http://example.com/b"},
+		NumWorkers: 2,
+		CrawlDelay: time.Hour,
+		Client:     NewMockClient(withHold(testSite)),
+		Handler: func(resp *Response) {
+			if resp.URL == holdURL {
+				<-release
+			}
+		},
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waited := c.frontier().wait("http://example.com/b")
+
+	// The second seed waits out the crawl delay while the first is held, so it is still pending when its state is restored
+	waitForState(t, c, holdURL, StateRunning)
+	c.AddWithState(map[string]State{"http://example.com/b": StateRejected})
+	select {
+	case state := <-waited:
+		if state != StateRejected {
+			t.Errorf("Expected the waiter to receive StateRejected, got %v", state)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the waiter to be released once the URL's state was restored")
+	}
+	close(release)
+	waitFor(t, c)
+}
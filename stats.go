@@ -0,0 +1,84 @@
+package crawlbot
+
+import (
+	"time"
+)
+
+// Statistics about a crawl. You can get the current statistics by calling Crawler.Stats()
+type Stats struct {
+	// The number of URLs currently in each state
+	Pending  int
+	Running  int
+	Rejected int
+	Done     int
+
+	// The highest number of URLs there have been in StatePending and StateRunning at once.
+	// A high peak of pending URLs with running URLs at NumWorkers means the workers are the bottleneck.
+	PeakPending int
+	PeakRunning int
+
+	// The total number of URLs that have been processed
+	Requests int
+
+	// The number of processed URLs that resulted in an error
+	Errors int
+
+	// The number of processed URLs that resulted in an error, by the kind of error. Errors that didn't come from the
+	// request itself, such as a rejected header or a failure to parse the body, are counted as ErrKindOther.
+	ErrorsByKind map[ErrKind]int
+
+	// The total number of response body bytes read
+	Bytes int64
+}
+
+// Get the current statistics for the crawl
+func (c *Crawler) Stats() Stats {
+	c.mux.Lock()
+	stats := c.stats
+	stats.ErrorsByKind = make(map[ErrKind]int, len(c.stats.ErrorsByKind))
+	for kind, n := range c.stats.ErrorsByKind {
+		stats.ErrorsByKind[kind] = n
+	}
+	c.mux.Unlock()
+
+	frontier := c.frontier()
+	stats.Pending = frontier.numstate(StatePending)
+	stats.Running = frontier.numstate(StateRunning)
+	stats.Rejected = frontier.numstate(StateRejected)
+	stats.Done = frontier.numstate(StateDone)
+	stats.PeakPending, stats.PeakRunning = frontier.peaks()
+
+	return stats
+}
+
+// Add a result to the running totals. Must be called with the crawler's mutex held.
+func (c *Crawler) recordStats(res result) {
+	c.stats.Requests++
+	if res.err != nil {
+		c.stats.Errors++
+		kind := res.resp.errKind
+		if kind == ErrKindNone {
+			kind = ErrKindOther
+		}
+		if c.stats.ErrorsByKind == nil {
+			c.stats.ErrorsByKind = make(map[ErrKind]int)
+		}
+		c.stats.ErrorsByKind[kind]++
+	}
+	c.stats.Bytes += int64(len(res.resp.bytes))
+}
+
+// Call Sampler with the number of pending and running URLs every SampleInterval until finished is closed
+func (c *Crawler) sample(finished chan bool) {
+	ticker := time.NewTicker(c.SampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+			c.Sampler(c.urlstate.numstate(StatePending), c.urlstate.numstate(StateRunning))
+		}
+	}
+}
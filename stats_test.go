@@ -0,0 +1,104 @@
+package crawlbot
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	pages := map[string]MockResponse{}
+	for url, page := range testSite {
+		pages[url] = page
+	}
+	pages["http://example.com/c"] = MockResponse{Body: `<a href="/missing">missing</a>`}
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 2, Handler: func(resp *Response) {}, Client: NewMockClient(pages)}
+
+	// Stats can be called before the crawler is started
+	if stats := c.Stats(); stats.Requests != 0 || stats.Pending != 0 {
+		t.Errorf("Expected empty stats before starting, got %+v", stats)
+	}
+	crawl(t, c)
+
+	stats := c.Stats()
+	if stats.Requests != 5 || stats.Done != 4 || stats.Rejected != 1 || stats.Pending != 0 || stats.Running != 0 {
+		t.Errorf("Expected 5 requests, 4 done and 1 rejected, got %+v", stats)
+	}
+	if stats.Errors != 1 || stats.ErrorsByKind[ErrKindOther] != 1 {
+		t.Errorf("Expected the 404 to be counted as an error, got %+v", stats)
+	}
+	var bytes int64
+	for _, page := range pages {
+		bytes += int64(len(page.Body))
+	}
+	if stats.Bytes != bytes {
+		t.Errorf("Expected %d bytes, got %d", bytes, stats.Bytes)
+	}
+}
+
+func TestStatsErrorKinds(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/":        {Body: `<a href="/busy">busy</a><a href="/limited">limited</a>`},
+		"http://example.com/busy":    {StatusCode: http.StatusServiceUnavailable},
+		"http://example.com/limited": {StatusCode: http.StatusTooManyRequests},
+	}
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 2, Handler: func(resp *Response) {}, Client: NewMockClient(pages)}
+	crawl(t, c)
+
+	stats := c.Stats()
+	if stats.Errors != 2 || stats.ErrorsByKind[ErrKindServer] != 1 || stats.ErrorsByKind[ErrKindTooManyRequests] != 1 {
+		t.Errorf("Expected a server error and a too many requests error, got %+v", stats)
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	var body strings.Builder
+	pages := map[string]MockResponse{}
+	for i := 0; i < 20; i++ {
+		page := "/" + strconv.Itoa(i)
+		body.WriteString(`<a href="` + page + `">x</a>`)
+		pages["http://example.com"+page] = MockResponse{}
+	}
+	pages["http://example.com/"] = MockResponse{Body: body.String()}
+	transport := newTestTransport(pages)
+	transport.delay = 5 * time.Millisecond
+
+	var mux sync.Mutex
+	samples := 0
+	maxPending := 0
+	c := &Crawler{
+		URLs:           []string{"http://example.com/"},
+		NumWorkers:     3,
+		Handler:        func(resp *Response) {},
+		Client:         transport.client,
+		SampleInterval: 5 * time.Millisecond,
+		Sampler: func(pending, running int) {
+			mux.Lock()
+			defer mux.Unlock()
+			samples++
+			if pending > maxPending {
+				maxPending = pending
+			}
+			if running > 3 {
+				t.Errorf("Sampled %d running URLs with 3 workers", running)
+			}
+		},
+	}
+	crawl(t, c)
+
+	stats := c.Stats()
+	if stats.PeakPending < 17 || stats.PeakPending > 20 {
+		t.Errorf("Expected a peak of nearly 20 pending URLs, got %d", stats.PeakPending)
+	}
+	if stats.PeakRunning != 3 {
+		t.Errorf("Expected every worker to be busy at the peak, got %d running", stats.PeakRunning)
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	if samples == 0 || maxPending == 0 {
+		t.Errorf("Expected Sampler to observe the queue, got %d samples with a maximum of %d pending", samples, maxPending)
+	}
+}
@@ -0,0 +1,59 @@
+package crawlbot
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// A line of the stream written by StreamResultsJSON
+type streamedResult struct {
+	URL           string `json:"url"`
+	Status        int    `json:"status,omitempty"`
+	ContentType   string `json:"content_type,omitempty"`
+	Length        int    `json:"length"`
+	LinksFound    int    `json:"links_found"`
+	LinksFollowed int    `json:"links_followed"`
+	Error         string `json:"error,omitempty"`
+}
+
+// Write each processed URL to w as a line of JSON as the crawl proceeds, for piping into other tools.
+// Each line has the URL, status code, content type, body length, number of links found and followed, and any error.
+// Lines are written one at a time even though workers run concurrently, by the worker that processed the URL before
+// the result is handed back to the crawler, so a slow writer holds up that worker but not the rest of the crawl.
+// w may call methods of the crawler such as Stats(). Pass nil to stop streaming.
+func (c *Crawler) StreamResultsJSON(w io.Writer) {
+	c.streamMux.Lock()
+	defer c.streamMux.Unlock()
+
+	if w == nil {
+		c.stream = nil
+	} else {
+		c.stream = json.NewEncoder(w)
+	}
+}
+
+// Write a result to the stream, if there is one
+func (c *Crawler) streamResult(res result) {
+	c.streamMux.Lock()
+	defer c.streamMux.Unlock()
+
+	if c.stream == nil {
+		return
+	}
+	line := streamedResult{
+		URL:           res.url,
+		Length:        len(res.resp.bytes),
+		LinksFound:    res.resp.LinksFound,
+		LinksFollowed: res.resp.LinksFollowed,
+	}
+	if res.resp.Response != nil {
+		line.Status = res.resp.StatusCode
+		line.ContentType = res.resp.Header.Get("Content-Type")
+	}
+	if res.err != nil {
+		line.Error = res.err.Error()
+	}
+
+	// A failed write can't be reported back to the crawl, so it is dropped
+	c.stream.Encode(line)
+}
@@ -0,0 +1,56 @@
+package crawlbot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+// A writer that calls back into the crawler on every write
+type statsWriter struct {
+	crawler *Crawler
+
+	mux sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *statsWriter) Write(p []byte) (int, error) {
+	w.crawler.Stats()
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.buf.Write(p)
+}
+
+func TestStreamResultsJSON(t *testing.T) {
+	pages := map[string]MockResponse{}
+	for url, page := range testSite {
+		pages[url] = page
+	}
+	pages["http://example.com/c"] = MockResponse{Body: `<a href="/missing">missing</a>`}
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 2, Handler: func(resp *Response) {}, Client: NewMockClient(pages)}
+	w := &statsWriter{crawler: c}
+	c.StreamResultsJSON(w)
+	crawl(t, c)
+
+	lines := make(map[string]streamedResult)
+	scanner := bufio.NewScanner(&w.buf)
+	for scanner.Scan() {
+		var line streamedResult
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Invalid line %q: %v", scanner.Text(), err)
+		}
+		lines[line.URL] = line
+	}
+	if len(lines) != 5 {
+		t.Fatalf("Expected a line for each of the 5 processed URLs, got %d", len(lines))
+	}
+	root := lines["http://example.com/"]
+	if root.Status != 200 || root.ContentType != "text/html; charset=utf-8" || root.Length != len(pages["http://example.com/"].Body) || root.LinksFound != 3 || root.LinksFollowed != 2 || root.Error != "" {
+		t.Errorf("Unexpected line for the root page: %+v", root)
+	}
+	if missing := lines["http://example.com/missing"]; missing.Status != 404 || missing.Error == "" {
+		t.Errorf("Expected the missing page to be streamed with its error, got %+v", missing)
+	}
+}
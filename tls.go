@@ -0,0 +1,66 @@
+package crawlbot
+
+import (
+	"time"
+)
+
+// Certificates expiring within this long of being seen are flagged as ExpiringSoon
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// Details of the TLS certificate presented by an HTTPS host.
+// You can query the certificate for a host by calling Crawler.TLSInfo(host)
+type CertInfo struct {
+	// The host the certificate was presented by
+	Host string
+
+	// The subject and issuer of the leaf certificate
+	Subject string
+	Issuer  string
+
+	// The validity period of the leaf certificate
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// The DNS names in the certificate's Subject Alternative Names
+	DNSNames []string
+
+	// True if the certificate had already expired, or expired within 30 days, when it was seen
+	ExpiringSoon bool
+
+	// When the certificate was last seen
+	Seen time.Time
+}
+
+// Get the TLS certificate details for an HTTPS host encountered during the crawl.
+// ok is false if no HTTPS response has been received from the host.
+func (c *Crawler) TLSInfo(host string) (info CertInfo, ok bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	info, ok = c.certs[host]
+	return info, ok
+}
+
+// Record the leaf certificate of a response. Must be called with the crawler's mutex held.
+func (c *Crawler) recordCert(resp *Response) {
+	if len(resp.TLS.PeerCertificates) == 0 || resp.Request == nil {
+		return
+	}
+	cert := resp.TLS.PeerCertificates[0]
+	host := resp.Request.URL.Host
+	now := time.Now()
+
+	if c.certs == nil {
+		c.certs = make(map[string]CertInfo)
+	}
+	c.certs[host] = CertInfo{
+		Host:         host,
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		DNSNames:     cert.DNSNames,
+		ExpiringSoon: now.Add(certExpiryWarning).After(cert.NotAfter),
+		Seen:         now,
+	}
+}
@@ -0,0 +1,43 @@
+package crawlbot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTLSInfo(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("secure"))
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	c := &Crawler{URLs: []string{server.URL + "/"}, NumWorkers: 1, Handler: func(resp *Response) {}, Client: server.Client}
+	if _, ok := c.TLSInfo(host); ok {
+		t.Error("Expected no certificate before the host has been crawled")
+	}
+	start := time.Now()
+	crawl(t, c)
+
+	info, ok := c.TLSInfo(host)
+	if !ok {
+		t.Fatal("Expected the certificate of an HTTPS host to be recorded")
+	}
+	cert := server.Certificate()
+	if info.Host != host || info.Subject != cert.Subject.String() || info.Issuer != cert.Issuer.String() {
+		t.Errorf("Certificate details don't match the server's certificate: %+v", info)
+	}
+	if !info.NotAfter.Equal(cert.NotAfter) || !info.NotBefore.Equal(cert.NotBefore) || len(info.DNSNames) != len(cert.DNSNames) {
+		t.Errorf("Certificate validity doesn't match the server's certificate: %+v", info)
+	}
+	if info.ExpiringSoon != start.Add(certExpiryWarning).After(cert.NotAfter) {
+		t.Errorf("Expected ExpiringSoon to reflect the certificate's expiry of %s", cert.NotAfter)
+	}
+	if info.Seen.Before(start) {
+		t.Errorf("Expected the certificate to have been seen during the crawl, got %s", info.Seen)
+	}
+}
@@ -1,25 +1,69 @@
 package crawlbot
 
 import (
+	"math/rand"
+	"net/url"
 	"sync"
+	"time"
 )
 
+// The frontier of URLs. All maps and queues are keyed by the dedup key of a URL, which is the URL itself unless a key function is set.
 type urls struct {
 	sync.RWMutex                           // A mutex for protecting urls and urlindex
 	urls         map[string]State          // List of URLs and their current state.
 	index        map[State]map[string]bool // Index of URLs by their state
+	links        map[string][]string       // Link graph of URLs to the URLs they link to. Only recorded if RecordLinkGraph is set.
+	retries      map[string]int            // Number of times a URL has been re-queued
+	requeued     map[string]bool           // Running URLs that should be re-queued once they finish
+	compact      bool                      // If true, done and rejected URLs are evicted and remembered only in seen
+	seen         seenSet                   // Evicted URLs
+	seeds        tier                      // Pending seed URLs, which are dispatched before discovered URLs
+	discovered   tier                      // Pending discovered URLs
+	partition    bool                      // If true, each tier has a separate queue for each host
+	order        QueueOrder                // The order in which URLs are taken from the queues
+	key          func(url string) string   // Computes the key URLs are deduplicated and tracked by. nil means the URL itself.
+	deny         func(url string) bool     // Reports URLs that must never be crawled, which are rejected. nil means none are.
+	reps         map[string]string         // Representative URL for each key. Only recorded if key is set.
+	depths       map[string]int            // The shallowest depth each URL was found at. Seeds are depth 0.
+	maxDepth     int                       // Maximum depth. URLs found deeper are rejected. 0 means unlimited.
+	notifier     *notifier                 // Receives state changes. nil means state changes are not reported.
+	hosts        map[string]bool           // Distinct hosts that have been added
+	maxHosts     int                       // Maximum number of distinct hosts. URLs on further hosts are rejected. 0 means unlimited.
+	shuffle      bool                      // If true, URLs are taken at random from the next few in the queue
+	timeouts     map[string]time.Duration  // Request timeouts for specific URLs
+	waiters      map[string][]chan State   // Channels waiting for URLs to finish
+	stopped      bool                      // If true, the crawler has stopped and waiters are given the current state immediately
+	peakPending  int                       // The highest number of pending URLs there have been at once
+	peakRunning  int                       // The highest number of running URLs there have been at once
+	wake         chan bool                 // Signalled when URLs become pending, to wake the scheduler. nil means there is no scheduler.
 }
 
-func newUrls(seeds []string) *urls {
-	u := urls{
-		urls:  make(map[string]State),
-		index: make(map[State]map[string]bool),
-	}
+// The number of URLs at the front of the queue that are picked from at random when shuffling
+const shuffleWindow = 8
+
+// A tier of the frontier, holding a queue of pending keys for each partition.
+// Without partitioning there is a single partition named "". With partitioning each host is a partition.
+type tier struct {
+	queues   map[string][]string // Queue of pending keys for each partition. Every partition in queues is in rotation.
+	rotation []string            // Partitions in the order they are taken from
+}
 
-	// Initialize with seeds urls
-	for _, seed := range seeds {
-		u.urls[seed] = StatePending
+func newUrls() *urls {
+	u := urls{
+		urls:     make(map[string]State),
+		index:    make(map[State]map[string]bool),
+		links:    make(map[string][]string),
+		retries:  make(map[string]int),
+		requeued: make(map[string]bool),
+		seen:     make(hashSet),
+		reps:     make(map[string]string),
+		depths:   make(map[string]int),
+		hosts:    make(map[string]bool),
+		timeouts: make(map[string]time.Duration),
+		waiters:  make(map[string][]chan State),
 	}
+	u.seeds.queues = make(map[string][]string)
+	u.discovered.queues = make(map[string][]string)
 
 	// build the index
 	u.buildIndex()
@@ -41,18 +85,265 @@ func (u *urls) buildIndex() {
 }
 
 // Add new urls to our url list.
-// If an item already exists it's a no-op
-func (u *urls) add(urls []string) {
+// Seed urls are dispatched before any discovered urls. depth is the depth the urls were found at.
+// If an item already exists it's a no-op, other than recording depth if it is shallower.
+func (u *urls) add(urls []string, seed bool, depth int) {
 	u.Lock()
 	defer u.Unlock()
 
 	for _, url := range urls {
-		if _, ok := u.urls[url]; ok {
+		key := u.keyOf(url)
+		if state, ok := u.urls[key]; ok {
+			u.reduceDepth(url, key, state, depth, seed)
+			continue
+		}
+		if u.seen.has(key) {
+			continue
+		}
+		if u.key != nil {
+			u.reps[key] = url
+		}
+
+		// Reject URLs that are too deep
+		u.depths[key] = depth
+		if u.maxDepth > 0 && depth > u.maxDepth {
+			u.reject(key)
+			continue
+		}
+
+		// Reject URLs on the deny list, and URLs on new hosts once we have reached the maximum number of hosts
+		if (u.deny != nil && u.deny(url)) || !u.admitHost(url) {
+			u.reject(key)
+			continue
+		}
+
+		u.urls[key] = StatePending
+		u.index[StatePending][key] = true
+		u.enqueue(key, seed)
+		u.changed(key, StateNotFound, StatePending)
+	}
+	u.updatePeaks()
+	u.signal()
+}
+
+// Check if a url's host may be crawled, recording the host if it is new and we haven't reached the maximum
+// number of hosts. Must be called with the lock held.
+func (u *urls) admitHost(url string) bool {
+	host := hostOf(url)
+	if u.hosts[host] {
+		return true
+	}
+	if u.maxHosts > 0 && len(u.hosts) >= u.maxHosts {
+		return false
+	}
+	u.hosts[host] = true
+	return true
+}
+
+// Record a shallower depth for a known key. A key rejected for being deeper than maxDepth is made pending
+// if it is now within maxDepth and its host is admitted. Must be called with the lock held.
+func (u *urls) reduceDepth(url, key string, state State, depth int, seed bool) {
+	old, ok := u.depths[key]
+	if ok && depth >= old {
+		return
+	}
+	u.depths[key] = depth
+
+	if ok && state == StateRejected && u.maxDepth > 0 && old > u.maxDepth && depth <= u.maxDepth && u.admitHost(url) {
+		u.urls[key] = StatePending
+		delete(u.index[StateRejected], key)
+		u.index[StatePending][key] = true
+		u.enqueue(key, seed)
+		u.changed(key, StateRejected, StatePending)
+	}
+}
+
+// Get the depth a url was found at. Urls without a recorded depth, such as those restored from a saved state, are depth 0.
+func (u *urls) depth(url string) int {
+	depth, _ := u.lookupDepth(url)
+	return depth
+}
+
+// Get the depth a url was found at, and whether the url is in the frontier. Evicted urls are not.
+func (u *urls) lookupDepth(url string) (int, bool) {
+	u.RLock()
+	defer u.RUnlock()
+
+	key := u.keyOf(url)
+	if _, ok := u.urls[key]; !ok {
+		return 0, false
+	}
+	return u.depths[key], true
+}
+
+// Mark urls as done without them being crawled. Unknown urls are added as done and pending urls are moved to done.
+func (u *urls) markDone(urls []string) {
+	u.Lock()
+	defer u.Unlock()
+
+	for _, url := range urls {
+		key := u.keyOf(url)
+		state, ok := u.urls[key]
+		if ok && state != StatePending {
+			continue
+		}
+		if !ok && u.seen.has(key) {
+			continue
+		}
+		if !ok {
+			state = StateNotFound
+			if u.key != nil {
+				u.reps[key] = url
+			}
+		}
+		delete(u.index[state], key)
+		u.changed(key, state, StateDone)
+		u.release(key, StateDone)
+
+		if u.compact {
+			delete(u.urls, key)
+			delete(u.reps, key)
+			delete(u.depths, key)
+			u.seen.add(key)
+		} else {
+			u.urls[key] = StateDone
+			u.index[StateDone][key] = true
+		}
+	}
+
+	// The scheduler may be waiting on URLs that are now done
+	u.signal()
+}
+
+// Set the state of urls, adding them if they are unknown. This is used to resume a previous crawl, so urls that were
+// running are made pending again. Urls that are currently running are left as they are.
+func (u *urls) restore(entries map[string]State) {
+	u.Lock()
+	defer u.Unlock()
+
+	for url, state := range entries {
+		switch state {
+		case StateRunning:
+			state = StatePending
+		case StateSeen:
+			state = StateDone
+		case StateNotFound:
+			continue
+		}
+
+		key := u.keyOf(url)
+		oldstate, ok := u.urls[key]
+		if ok && oldstate == StateRunning {
+			continue
+		}
+		if ok {
+			delete(u.index[oldstate], key)
+		} else {
+			if u.seen.has(key) {
+				continue
+			}
+			oldstate = StateNotFound
+			if u.key != nil {
+				u.reps[key] = url
+			}
+			u.hosts[hostOf(url)] = true
+		}
+		u.changed(key, oldstate, state)
+		if state == StateDone || state == StateRejected {
+			u.release(key, state)
+		}
+
+		if u.compact && (state == StateDone || state == StateRejected) {
+			delete(u.urls, key)
+			delete(u.reps, key)
+			delete(u.depths, key)
+			u.seen.add(key)
 			continue
 		}
-		u.urls[url] = StatePending
-		u.index[StatePending][url] = true
+		u.urls[key] = state
+		u.index[state][key] = true
+		if state == StatePending && oldstate != StatePending {
+			u.enqueue(key, false)
+		}
+	}
+	u.updatePeaks()
+	u.signal()
+}
+
+// Add a new key directly in a rejected state. Must be called with the lock held.
+func (u *urls) reject(key string) {
+	if u.compact {
+		delete(u.reps, key)
+		delete(u.depths, key)
+		u.seen.add(key)
+	} else {
+		u.urls[key] = StateRejected
+		u.index[StateRejected][key] = true
+	}
+	u.changed(key, StateNotFound, StateRejected)
+}
+
+// Push a pending key onto the back of its queue. Must be called with the lock held.
+func (u *urls) enqueue(key string, seed bool) {
+	t := &u.discovered
+	if seed {
+		t = &u.seeds
+	}
+	name := u.partitionOf(u.urlOf(key))
+	if _, ok := t.queues[name]; !ok {
+		t.rotation = append(t.rotation, name)
+	}
+	t.queues[name] = append(t.queues[name], key)
+}
+
+// Get the name of the partition a URL is queued in. Must be called with the lock held.
+func (u *urls) partitionOf(url string) string {
+	if !u.partition {
+		return ""
+	}
+	return hostOf(url)
+}
+
+// Turn partitioning by host on or off, moving any queued URLs into their new partitions
+func (u *urls) setPartition(partition bool) {
+	u.Lock()
+	defer u.Unlock()
+
+	if partition == u.partition {
+		return
+	}
+	u.partition = partition
+	for _, seed := range []bool{true, false} {
+		t := &u.discovered
+		if seed {
+			t = &u.seeds
+		}
+		old := *t
+		*t = tier{queues: make(map[string][]string)}
+		for _, name := range old.rotation {
+			for _, key := range old.queues[name] {
+				if u.urls[key] == StatePending {
+					u.enqueue(key, seed)
+				}
+			}
+		}
+	}
+}
+
+// Get the dedup key for a URL
+func (u *urls) keyOf(url string) string {
+	if u.key == nil {
+		return url
 	}
+	return u.key(url)
+}
+
+// Get the representative URL for a key. Must be called with the lock held.
+func (u *urls) urlOf(key string) string {
+	if rep, ok := u.reps[key]; ok {
+		return rep
+	}
+	return key
 }
 
 // Change the state of a URL.
@@ -61,13 +352,128 @@ func (u *urls) changeState(url string, state State) {
 	u.Lock()
 	defer u.Unlock()
 
-	oldstate, ok := u.urls[url]
+	key := u.keyOf(url)
+	oldstate, ok := u.urls[key]
 	if !ok {
 		panic("Cannot change state of url that does not exist.")
 	}
-	u.urls[url] = state
-	delete(u.index[oldstate], url)
-	u.index[state][url] = true
+	delete(u.index[oldstate], key)
+	u.changed(key, oldstate, state)
+	if state == StateDone || state == StateRejected {
+		u.release(key, state)
+	}
+
+	// Evict completed URLs if we are compacting
+	if u.compact && (state == StateDone || state == StateRejected) {
+		delete(u.urls, key)
+		delete(u.retries, key)
+		delete(u.reps, key)
+		delete(u.depths, key)
+		u.seen.add(key)
+		return
+	}
+
+	u.urls[key] = state
+	u.index[state][key] = true
+	if state == StatePending {
+		u.enqueue(key, false)
+		u.updatePeaks()
+		u.signal()
+	}
+}
+
+// Change the state of a running URL that has finished processing.
+// If the URL was re-queued while it was running it is moved back to pending instead.
+func (u *urls) finish(url string, state State) {
+	u.Lock()
+	key := u.keyOf(url)
+	requeued := u.requeued[key]
+	delete(u.requeued, key)
+	u.Unlock()
+
+	if requeued {
+		state = StatePending
+	}
+	u.changeState(url, state)
+}
+
+// Re-queue a URL, moving it back to pending.
+// Running URLs are flagged to be moved back to pending when they finish.
+func (u *urls) requeue(url string, maxRetries int) error {
+	u.Lock()
+	defer u.Unlock()
+
+	key := u.keyOf(url)
+	state, ok := u.urls[key]
+	if !ok {
+		return ErrURLNotFound
+	}
+	if state == StatePending || u.requeued[key] {
+		return nil
+	}
+	if maxRetries > 0 && u.retries[key] >= maxRetries {
+		return ErrMaxRetries
+	}
+	u.retries[key]++
+
+	if state == StateRunning {
+		u.requeued[key] = true
+	} else {
+		u.urls[key] = StatePending
+		delete(u.index[state], key)
+		u.index[StatePending][key] = true
+		u.enqueue(key, false)
+		u.changed(key, state, StatePending)
+		u.updatePeaks()
+		u.signal()
+	}
+	return nil
+}
+
+// Set the request timeout for a url
+func (u *urls) setTimeout(url string, timeout time.Duration) {
+	u.Lock()
+	defer u.Unlock()
+
+	u.timeouts[u.keyOf(url)] = timeout
+}
+
+// Get the request timeout for a url, if it has one
+func (u *urls) timeout(url string) (timeout time.Duration, ok bool) {
+	u.RLock()
+	defer u.RUnlock()
+
+	timeout, ok = u.timeouts[u.keyOf(url)]
+	return timeout, ok
+}
+
+// Move a done or rejected url back to pending so it is crawled again, as a seed.
+// Returns ErrURLRunning if the url is running, and ErrURLNotFound if it is unknown or was evicted.
+func (u *urls) recrawl(url string) error {
+	u.Lock()
+	defer u.Unlock()
+
+	key := u.keyOf(url)
+	state, ok := u.urls[key]
+	switch {
+	case !ok:
+		return ErrURLNotFound
+	case state == StateRunning:
+		return ErrURLRunning
+	case state == StatePending:
+		return nil
+	case u.deny != nil && u.deny(url):
+		return ErrDenied
+	}
+
+	u.urls[key] = StatePending
+	delete(u.index[state], key)
+	u.index[StatePending][key] = true
+	u.enqueue(key, true)
+	u.changed(key, state, StatePending)
+	u.updatePeaks()
+	u.signal()
+	return nil
 }
 
 // Get a URL state
@@ -75,14 +481,85 @@ func (u *urls) state(url string) State {
 	u.RLock()
 	defer u.RUnlock()
 
-	state, ok := u.urls[url]
+	key := u.keyOf(url)
+	state, ok := u.urls[key]
 	if !ok {
+		if u.seen.has(key) {
+			return StateSeen
+		}
 		return StateNotFound
 	}
 
 	return state
 }
 
+// Get a channel that receives the state of a URL once it has finished.
+// If the URL is not pending or running the channel receives its current state immediately.
+func (u *urls) wait(url string) <-chan State {
+	u.Lock()
+	defer u.Unlock()
+
+	ch := make(chan State, 1)
+	key := u.keyOf(url)
+	state, ok := u.urls[key]
+	switch {
+	case !ok && u.seen.has(key):
+		ch <- StateSeen
+	case !ok:
+		ch <- StateNotFound
+	case u.stopped:
+		ch <- state
+	case state == StatePending || state == StateRunning:
+		u.waiters[key] = append(u.waiters[key], ch)
+	default:
+		ch <- state
+	}
+	return ch
+}
+
+// Send a state to everything waiting on a URL. Must be called with the lock held.
+func (u *urls) release(key string, state State) {
+	for _, ch := range u.waiters[key] {
+		ch <- state
+	}
+	delete(u.waiters, key)
+}
+
+// Send the current state to everything waiting on any URL when the crawler stops
+func (u *urls) releaseAll() {
+	u.Lock()
+	defer u.Unlock()
+
+	u.stopped = true
+	for key := range u.waiters {
+		u.release(key, u.urls[key])
+	}
+}
+
+// Get all URLs
+func (u *urls) all() []string {
+	u.RLock()
+	defer u.RUnlock()
+
+	all := make([]string, 0, len(u.urls))
+	for key := range u.urls {
+		all = append(all, u.urlOf(key))
+	}
+	return all
+}
+
+// Get a copy of the state of all URLs
+func (u *urls) snapshot() map[string]State {
+	u.RLock()
+	defer u.RUnlock()
+
+	snapshot := make(map[string]State, len(u.urls))
+	for key, state := range u.urls {
+		snapshot[u.urlOf(key)] = state
+	}
+	return snapshot
+}
+
 // Get the number of URls in a given state
 func (u *urls) numstate(state State) int {
 	u.Lock()
@@ -91,8 +568,41 @@ func (u *urls) numstate(state State) int {
 	return len(u.index[state])
 }
 
-// Select a random URL that is pending, move it to a running state, and return the select url
-func (u *urls) selectPending() (url string, ok bool) {
+// Get the highest number of pending and running URLs there have been at once
+func (u *urls) peaks() (pending, running int) {
+	u.RLock()
+	defer u.RUnlock()
+
+	return u.peakPending, u.peakRunning
+}
+
+// Wake the scheduler, if it is waiting, because URLs have become pending. Must be called with the lock held.
+func (u *urls) signal() {
+	if u.wake == nil {
+		return
+	}
+	select {
+	case u.wake <- true:
+	default:
+	}
+}
+
+// Update the peak numbers of pending and running URLs. Must be called with the lock held.
+func (u *urls) updatePeaks() {
+	if n := len(u.index[StatePending]); n > u.peakPending {
+		u.peakPending = n
+	}
+	if n := len(u.index[StateRunning]); n > u.peakRunning {
+		u.peakRunning = n
+	}
+}
+
+// Select the next pending URL, move it to a running state, and return the selected url.
+// Seed URLs are selected before discovered URLs, and each queue is consumed in the configured order.
+// When partitioned by host, hosts are selected from in turn.
+// If allow is not nil, only pending URLs on hosts it returns true for may be selected.
+// If prefer is not empty, the next allowed pending URL on that host is selected if there is one.
+func (u *urls) selectPending(prefer string, allow func(host string) bool) (url string, ok bool) {
 	u.Lock()
 	defer u.Unlock()
 
@@ -100,12 +610,180 @@ func (u *urls) selectPending() (url string, ok bool) {
 		return "", false
 	}
 
-	for url = range u.index[StatePending] {
-		u.urls[url] = StateRunning
-		delete(u.index[StatePending], url)
-		u.index[StateRunning][url] = true
+	key, ok := "", false
+	if prefer != "" && (allow == nil || allow(prefer)) {
+		key, ok = u.takePreferred(prefer)
+	}
+	if !ok {
+		key, ok = u.take(allow)
+	}
+	if !ok {
+		return "", false
+	}
+
+	u.urls[key] = StateRunning
+	delete(u.index[StatePending], key)
+	u.index[StateRunning][key] = true
+	u.changed(key, StatePending, StateRunning)
+	u.updatePeaks()
+
+	return u.urlOf(key), true
+}
+
+// Remove and return the next pending key on a host. Must be called with the lock held.
+func (u *urls) takePreferred(host string) (key string, ok bool) {
+	for _, t := range []*tier{&u.seeds, &u.discovered} {
+		if u.partition {
+			// The partition is left in place even if it is empty, as it is still in rotation
+			key, ok = u.takeFrom(t, host, nil)
+		} else {
+			key, ok = u.takeFrom(t, "", func(url string) bool {
+				return hostOf(url) == host
+			})
+		}
+		if ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Remove and return the next pending key on a host that satisfies allow, taking from each partition in turn.
+// When partitioned, a host that isn't allowed is skipped without looking at its URLs. A nil allow allows any host.
+// Must be called with the lock held.
+func (u *urls) take(allow func(host string) bool) (key string, ok bool) {
+	for _, t := range []*tier{&u.seeds, &u.discovered} {
+		for n := len(t.rotation); n > 0; n-- {
+			name := t.rotation[0]
+			t.rotation = t.rotation[1:]
+
+			var match func(url string) bool
+			if u.partition {
+				if allow != nil && !allow(name) {
+					t.rotation = append(t.rotation, name)
+					continue
+				}
+			} else if allow != nil {
+				match = func(url string) bool {
+					return allow(hostOf(url))
+				}
+			}
 
-		return url, true
+			key, ok = u.takeFrom(t, name, match)
+
+			// Drop empty partitions from the rotation, otherwise send the partition to the back
+			if len(t.queues[name]) == 0 {
+				delete(t.queues, name)
+			} else {
+				t.rotation = append(t.rotation, name)
+			}
+			if ok {
+				return key, true
+			}
+		}
 	}
 	return "", false
 }
+
+// Remove and return the next pending key from a partition's queue whose URL satisfies match. A nil match matches any URL.
+// Must be called with the lock held.
+func (u *urls) takeFrom(t *tier, name string, match func(url string) bool) (key string, ok bool) {
+	queue, exists := t.queues[name]
+	if !exists {
+		return "", false
+	}
+	defer func() {
+		t.queues[name] = queue
+	}()
+
+	// Drop stale entries for URLs that are no longer pending from the end we consume from
+	for len(queue) != 0 {
+		end := 0
+		if u.order == QueueLIFO {
+			end = len(queue) - 1
+		}
+		if u.urls[queue[end]] == StatePending {
+			break
+		}
+		u.remove(&queue, end)
+	}
+
+	// Find the next matching entry, or if shuffling pick one of the next few at random
+	window := 1
+	if u.shuffle {
+		window = shuffleWindow
+	}
+	candidates := make([]int, 0, window)
+	for i := range queue {
+		j := i
+		if u.order == QueueLIFO {
+			j = len(queue) - 1 - i
+		}
+		if u.urls[queue[j]] != StatePending {
+			continue
+		}
+		if match != nil && !match(u.urlOf(queue[j])) {
+			continue
+		}
+		candidates = append(candidates, j)
+		if len(candidates) == window {
+			break
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	j := candidates[rand.Intn(len(candidates))]
+	key = queue[j]
+	u.remove(&queue, j)
+	return key, true
+}
+
+// Remove the entry at index i from a queue
+func (u *urls) remove(queue *[]string, i int) {
+	q := *queue
+	if i == 0 {
+		*queue = q[1:]
+		return
+	}
+	copy(q[i:], q[i+1:])
+	*queue = q[:len(q)-1]
+}
+
+// Record the links found on a page in the link graph
+func (u *urls) addLinks(url string, links []string) {
+	u.Lock()
+	defer u.Unlock()
+
+	from := u.urlOf(u.keyOf(url))
+	for _, link := range links {
+		u.links[from] = append(u.links[from], u.urlOf(u.keyOf(link)))
+	}
+}
+
+// Set the notifier that receives state changes, closing any previous notifier
+func (u *urls) setNotifier(n *notifier) {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.notifier != nil {
+		u.notifier.close()
+	}
+	u.notifier = n
+}
+
+// Report a state change to the notifier. Must be called with the lock held.
+func (u *urls) changed(key string, from, to State) {
+	if u.notifier != nil {
+		u.notifier.push(u.urlOf(key), from, to)
+	}
+}
+
+// Get the host of a URL, or an empty string if it can't be parsed
+func hostOf(rawurl string) string {
+	parsed, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
+}
@@ -0,0 +1,212 @@
+package crawlbot
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Create a frontier with pending URLs on numHosts hosts, perHost URLs on each, added host by host
+func testFrontier(numHosts, perHost int) *urls {
+	u := newUrls()
+	for h := 0; h < numHosts; h++ {
+		batch := make([]string, perHost)
+		for i := range batch {
+			batch[i] = "http://h" + strconv.Itoa(h) + ".com/" + strconv.Itoa(i)
+		}
+		u.add(batch, false, 1)
+	}
+	return u
+}
+
+func TestSelectPendingOrder(t *testing.T) {
+	u := testFrontier(1, 5)
+	u.add([]string{"http://seed.com/"}, true, 0)
+
+	expected := []string{"http://seed.com/", "http://h0.com/0", "http://h0.com/1", "http://h0.com/2", "http://h0.com/3", "http://h0.com/4"}
+	for _, want := range expected {
+		if got, ok := u.selectPending("", nil); !ok || got != want {
+			t.Fatalf("Expected %s, got %s", want, got)
+		}
+	}
+	if _, ok := u.selectPending("", nil); ok {
+		t.Error("Expected no more pending URLs")
+	}
+}
+
+func TestSelectPendingShuffle(t *testing.T) {
+	u := testFrontier(1, 100)
+	u.shuffle = true
+
+	queued := make(map[string]int, 100)
+	for i := 0; i < 100; i++ {
+		queued["http://h0.com/"+strconv.Itoa(i)] = i
+	}
+	shuffled := false
+	remaining := make(map[int]bool, 100)
+	for i := 0; i < 100; i++ {
+		remaining[i] = true
+	}
+	for i := 0; i < 100; i++ {
+		url, ok := u.selectPending("", nil)
+		if !ok {
+			t.Fatalf("Expected 100 pending URLs, got %d", i)
+		}
+		pos := queued[url]
+		if pos != i {
+			shuffled = true
+		}
+
+		// The URL must be one of the next few still in the queue
+		ahead := 0
+		for j := 0; j < pos; j++ {
+			if remaining[j] {
+				ahead++
+			}
+		}
+		if ahead >= shuffleWindow {
+			t.Errorf("%s was taken with %d URLs ahead of it, expected fewer than %d", url, ahead, shuffleWindow)
+		}
+		delete(remaining, pos)
+	}
+	if !shuffled {
+		t.Error("Expected URLs to be taken out of order")
+	}
+}
+
+func TestSelectPendingPartitioned(t *testing.T) {
+	u := testFrontier(3, 2)
+	u.setPartition(true)
+
+	// Hosts are taken from in turn
+	expected := []string{"http://h0.com/0", "http://h1.com/0", "http://h2.com/0", "http://h0.com/1", "http://h1.com/1", "http://h2.com/1"}
+	for _, want := range expected {
+		if got, _ := u.selectPending("", nil); got != want {
+			t.Fatalf("Expected %s, got %s", want, got)
+		}
+	}
+
+	// Only allowed hosts are taken from, and a preferred host is taken from first
+	u = testFrontier(3, 2)
+	u.setPartition(true)
+	allow := func(host string) bool { return host != "h0.com" }
+	if got, _ := u.selectPending("h2.com", allow); got != "http://h2.com/0" {
+		t.Errorf("Expected the preferred host to be selected, got %s", got)
+	}
+	if got, _ := u.selectPending("h0.com", allow); got != "http://h1.com/0" {
+		t.Errorf("Expected a preferred host that isn't allowed to be skipped, got %s", got)
+	}
+}
+
+func TestMaxDepthRevive(t *testing.T) {
+	u := newUrls()
+	u.maxDepth = 1
+	u.add([]string{"http://example.com/deep"}, false, 2)
+	if state := u.state("http://example.com/deep"); state != StateRejected {
+		t.Fatalf("Expected a URL beyond maxDepth to be rejected, got %v", state)
+	}
+	u.add([]string{"http://example.com/deep"}, false, 1)
+	if state := u.state("http://example.com/deep"); state != StatePending {
+		t.Errorf("Expected a URL found again within maxDepth to be pending, got %v", state)
+	}
+	if depth, ok := u.lookupDepth("http://example.com/deep"); !ok || depth != 1 {
+		t.Errorf("Expected the shallower depth to be recorded, got %d", depth)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	const n = 10000
+	b := newBloomFilter(n, 0.01)
+	for i := 0; i < n; i++ {
+		b.add("http://example.com/page/" + strconv.Itoa(i))
+	}
+	for i := 0; i < n; i++ {
+		if !b.has("http://example.com/page/" + strconv.Itoa(i)) {
+			t.Fatalf("Bloom filter is missing an added URL")
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if b.has("http://example.com/other/" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / n; rate > 0.03 {
+		t.Errorf("Expected a false positive rate near 0.01, got %f", rate)
+	}
+	if size := len(b.bits) * 8; size > 20000 {
+		t.Errorf("Expected a bloom filter for %d URLs to use under 20KB, got %d bytes", n, size)
+	}
+}
+
+func TestCompactCompleted(t *testing.T) {
+	transport := newTestTransport(testSite)
+	c := &Crawler{
+		URLs:             []string{"http://example.com/"},
+		NumWorkers:       2,
+		CompactCompleted: true,
+		Handler:          func(resp *Response) {},
+		Client:           transport.client,
+	}
+	crawl(t, c)
+
+	for url := range testSite {
+		if n := transport.count(url); n != 1 {
+			t.Errorf("Expected %s to be fetched once, got %d", url, n)
+		}
+		if state := c.State(url); state != StateSeen {
+			t.Errorf("Expected %s to be evicted, got %v", url, state)
+		}
+	}
+	if urls := c.AllURLs(); len(urls) != 0 {
+		t.Errorf("Expected no URLs to be kept, got %v", urls)
+	}
+}
+
+func TestBloomDedup(t *testing.T) {
+	transport := newTestTransport(testSite)
+	c := &Crawler{
+		URLs:       []string{"http://example.com/"},
+		NumWorkers: 2,
+		BloomDedup: true,
+		Handler:    func(resp *Response) {},
+		Client:     transport.client,
+	}
+	crawl(t, c)
+
+	for url := range testSite {
+		if n := transport.count(url); n != 1 {
+			t.Errorf("Expected %s to be fetched once, got %d", url, n)
+		}
+		if state := c.State(url); state != StateSeen {
+			t.Errorf("Expected %s to be evicted into the bloom filter, got %v", url, state)
+		}
+	}
+	if urls := c.AllURLs(); len(urls) != 0 {
+		t.Errorf("Expected no URLs to be kept, got %v", urls)
+	}
+}
+
+// Benchmark dispatch when only one host out of many may be crawled, as when every other host is waiting out its
+// politeness delay. Partitioning by host lets the scheduler skip the waiting hosts without looking at their URLs.
+func BenchmarkSelectPending(b *testing.B) {
+	for _, partition := range []bool{false, true} {
+		name := "linear"
+		if partition {
+			name = "partitioned"
+		}
+		b.Run(name, func(b *testing.B) {
+			u := testFrontier(1000, 10)
+			u.setPartition(partition)
+			allow := func(host string) bool { return host == "h999.com" }
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				url, ok := u.selectPending("", allow)
+				if !ok {
+					b.Fatal("Expected a pending URL")
+				}
+				u.changeState(url, StatePending)
+			}
+		})
+	}
+}
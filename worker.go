@@ -2,106 +2,497 @@ package crawlbot
 
 import (
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"fmt"
 	"github.com/phayes/errors"
+	"io"
 	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
+// The maximum random delay before each request when humanizing traffic
+const humanizeJitter = time.Second
+
 type worker struct {
-	state   bool         // true means busy / unavailable. false means idling and is ready for new work
-	url     string       // Current URL being processed
-	results chan result  // Channel on which to send results
-	crawler *Crawler     // It's parent crawler
-	client  *http.Client // The client to be used for HTTP connection
+	id      int                     // Index of the worker in the crawler's list of workers
+	state   bool                    // true means busy / unavailable. false means idling and is ready for new work
+	url     string                  // Current URL being processed
+	results chan result             // Channel on which to send results
+	crawler *Crawler                // It's parent crawler
+	client  *http.Client            // The client to be used for HTTP connection
+	clients map[string]*http.Client // Clients to be used for specific URL schemes, from Crawler.SchemeClients
+	last    time.Time               // When the worker last finished processing a URL
+	seq     int                     // Sequence number of the current URL
+	depth   int                     // Depth of the current URL
+	numreqs int                     // Number of requests made with the current client
+	cancel  context.CancelFunc      // Cancels the deadline set for the current URL by SetURLTimeout, if any
+
+	dispatched   time.Time // When the current URL was dispatched
+	prevDispatch time.Time // When the current URL's host was last dispatched to before that
+	checkPanic   error     // The first panic of CheckURL while processing the current URL, reported on the Response
 }
 
 type result struct {
-	err     error
-	url     string
-	newurls []string
-	owner   *worker
+	err        error
+	url        string
+	newurls    []string
+	owner      *worker
+	resp       *Response
+	rejected   bool
+	disallowed bool
+	cancelled  bool
 }
 
 // Process a given URL, when finish pass back a new list of URLs to process
 
+// setup must be called with the crawler's mutex held
 func (w *worker) setup(targetURL string) {
 	w.state = true
 	w.url = targetURL
+	w.crawler.seq++
+	w.seq = w.crawler.seq
+	w.depth = w.crawler.urlstate.depth(targetURL)
+	w.checkPanic = nil
 }
 
 func (w *worker) teardown() {
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
 	w.state = false
 	w.url = ""
+	w.last = time.Now()
+}
+
+// Sleep for a duration, returning early if the crawl is cancelled
+func (w *worker) sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-w.crawler.ctx.Done():
+	}
 }
 
 func (w *worker) process() {
 	go func() {
+		// Check robots.txt before doing anything else with the URL
+		if w.crawler.RespectRobots {
+			if allowed, rule := w.robotsAllowed(w.url); !allowed {
+				resp := Response{URL: w.url, Seq: w.seq, Depth: w.depth, WorkerID: w.id, Crawler: w.crawler}
+				if ctxErr := w.crawler.ctx.Err(); ctxErr != nil {
+					resp.Err = ctxErr
+					resp.cancelled = true
+				} else {
+					resp.Err = errors.Appends(ErrRobotsDisallowed, rule)
+					resp.rejected = true
+					resp.disallowed = true
+				}
+				w.handle(&resp)
+				w.sendResults(&resp, nil)
+				return
+			}
+		}
+
+		// Pace the worker if there is a per-worker delay
+		if w.crawler.PerWorkerDelay > 0 && !w.last.IsZero() {
+			w.sleep(w.crawler.PerWorkerDelay - time.Since(w.last))
+		}
+
+		// Add random jitter if we are humanizing traffic
+		if w.crawler.HumanizeTraffic {
+			w.sleep(time.Duration(rand.Int63n(int64(humanizeJitter))))
+		}
+
+		// Get a fresh client if the current one has been used enough, closing the old clients' idle connections
+		if w.crawler.RecycleClientAfter > 0 && w.numreqs >= w.crawler.RecycleClientAfter {
+			w.client.CloseIdleConnections()
+			for _, client := range w.clients {
+				client.CloseIdleConnections()
+			}
+			w.client = w.crawler.newClient(w.crawler.Client)
+			w.clients = nil
+			w.numreqs = 0
+		}
+		w.numreqs++
+
+		// Acquire a request slot if we are limiting concurrent requests
+		w.acquireRequest()
+
 		// Do the HTTP GET and create the response object
 		var resp Response
-		httpresp, err := w.client.Get(w.url)
+		var httpresp *http.Response
+		req, err := http.NewRequestWithContext(w.crawler.ctx, "GET", w.url, nil)
+		if err == nil {
+			w.setHeaders(req)
+			if w.crawler.Accept != "" {
+				req.Header.Set("Accept", w.crawler.Accept)
+			}
+			httpresp, err = w.doWithRetry(req)
+		}
 		if httpresp != nil {
 			resp = Response{Response: httpresp}
 		} else {
 			resp = Response{}
 		}
 		resp.URL = w.url
+		resp.Seq = w.seq
+		resp.Depth = w.depth
+		resp.WorkerID = w.id
 		resp.Crawler = w.crawler
+		if httpresp != nil && httpresp.Request != nil {
+			resp.Request = httpresp.Request
+		} else {
+			resp.Request = req
+		}
+		if httpresp != nil {
+			resp.FreshUntil = freshUntil(httpresp.Header, time.Now())
+		}
 		if err != nil {
-			resp.Err = errors.Wrap(err, ErrReqFailed)
-			w.crawler.Handler(&resp)
-			w.sendResults(nil, resp.Err)
+			w.releaseRequest()
+			resp.errKind = classifyErr(httpresp, err)
+			if ctxErr := w.crawler.ctx.Err(); ctxErr != nil {
+				// The crawl was cancelled, so report that rather than a failure of the request
+				resp.Err = ctxErr
+				resp.cancelled = true
+			} else if urlErr, ok := err.(*url.Error); ok && urlErr.Err == ErrSelfRedirect {
+				resp.Err = errors.Wrap(err, ErrSelfRedirect)
+			} else {
+				resp.Err = errors.Wrap(err, ErrReqFailed)
+			}
+			w.handle(&resp)
+			w.sendResults(&resp, nil)
 			return
 		}
 
+		// If redirects aren't being followed, check for a redirect back to the same URL
+		if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+			if location, err := resp.Location(); err == nil && sameURL(location, resp.Request.URL) {
+				resp.Err = ErrSelfRedirect
+				w.releaseRequest()
+				w.handle(&resp)
+				resp.Body.Close()
+				w.sendResults(&resp, nil)
+				return
+			}
+		}
+
 		// Check headers using HeaderCheck
 		if err = w.crawler.CheckHeader(w.crawler, w.url, resp.StatusCode, resp.Header); err != nil {
 			resp.Err = errors.Wrap(err, ErrHeaderRejected)
-			w.crawler.Handler(&resp)
+			resp.errKind = classifyErr(httpresp, nil)
+			resp.rejected = true
+			w.releaseRequest()
+			w.handle(&resp)
 			resp.Body.Close()
-			w.sendResults(nil, resp.Err)
+			w.sendResults(&resp, nil)
 			return
 		}
 
 		// Read the body
 		resp.bytes, err = ioutil.ReadAll(resp.Body)
 		resp.Body.Close()
+		w.releaseRequest()
 		if err != nil {
-			resp.Err = errors.Wrap(err, ErrBodyRead)
-			w.crawler.Handler(&resp)
-			w.sendResults(nil, resp.Err)
+			// Pass along whatever part of the body was read
+			resp.errKind = classifyErr(nil, err)
+			if ctxErr := w.crawler.ctx.Err(); ctxErr != nil {
+				resp.Err = ctxErr
+				resp.cancelled = true
+			} else if isDecompressionErr(err, resp.Uncompressed) {
+				resp.Err = errors.Wrap(err, ErrDecompression)
+			} else if isTimeoutErr(err) {
+				resp.Err = errors.Wrap(err, ErrBodyReadTimeout)
+			} else {
+				resp.Err = errors.Wrap(err, ErrBodyRead)
+			}
+			resp.Body = &readCloser{bytes.NewReader(resp.bytes)}
+			w.handle(&resp)
+			w.sendResults(&resp, nil)
 			return
 		}
+
+		// Transform the body
+		if w.crawler.TransformBody != nil {
+			resp.bytes = w.crawler.TransformBody(&resp, resp.bytes)
+		}
+
+		// Validate the body against its charset
+		if w.crawler.ValidateEncoding {
+			var charset string
+			charset, resp.EncodingWarning = resolveCharset(resp.Header, resp.bytes)
+			resp.EncodingIssue = validateCharset(charset, resp.bytes)
+		}
+
+		// Sniff the content type from the body
+		if w.crawler.SniffContentType {
+			resp.DetectedContentType = http.DetectContentType(resp.bytes)
+		}
+
+		// Parse the document once for everything that needs it
+		resp.document()
+
 		// Replace the body with a readCloser that reads from bytes
 		resp.Body = &readCloser{bytes.NewReader(resp.bytes)}
 
-		// Process the handler
-		w.crawler.Handler(&resp)
-		resp.Body = &readCloser{bytes.NewReader(resp.bytes)}
+		// Check for X-Robots-Tag directives
+		var noindex, nofollow bool
+		if w.crawler.RespectRobots {
+			noindex, nofollow = parseRobotsTag(resp.Header)
+		}
 
-		// Find links and finish
+		// Find links, counting how many were found and how many passed CheckURL
 		newurls := make([]string, 0)
-		for _, url := range w.crawler.LinkFinder(&resp) {
-			if err := w.crawler.CheckURL(w.crawler, url); err == nil {
-				newurls = append(newurls, url)
+		if !nofollow {
+			resp.LinksFound, newurls, err = w.findLinks(&resp)
+			if err != nil {
+				// Links a StreamingLinkFinder found before it panicked have already been queued, so still report them
+				resp.Err = err
+				resp.LinksFollowed = len(newurls)
+				resp.Body = &readCloser{bytes.NewReader(resp.bytes)}
+				w.handle(&resp)
+				w.sendResults(&resp, newurls)
+				return
+			}
+		}
+		resp.LinksFollowed = len(newurls)
+
+		// Find the next pages of paginated listings so they can be prioritized
+		if w.crawler.FollowPagination && !nofollow {
+			for _, url := range findNextPages(&resp) {
+				if err := w.checkURL(url); err == nil {
+					resp.next = append(resp.next, url)
+				}
+			}
+		}
+		resp.Body = &readCloser{bytes.NewReader(resp.bytes)}
+
+		// Report a panic in CheckURL. The links it didn't panic on are still followed.
+		if w.checkPanic != nil {
+			resp.Err = w.checkPanic
+		}
+
+		// Record the title
+		if w.crawler.TrackTitles {
+			if doc := resp.document(); doc != nil {
+				resp.title = strings.TrimSpace(doc.Find("title").First().Text())
 			}
 		}
 
+		// Record mixed content
+		if w.crawler.TrackMixedContent {
+			resp.mixed = findMixedContent(&resp)
+		}
+
+		// Process the handler
+		if !noindex {
+			w.handle(&resp)
+		}
+
 		// We're done, return the results
-		w.sendResults(newurls, nil)
+		w.sendResults(&resp, newurls)
+	}()
+}
+
+// Pass the response to the Handler, unless we are only discovering URLs
+func (w *worker) handle(resp *Response) {
+	if w.crawler.DiscoverOnly {
+		return
+	}
+
+	start := time.Now()
+	w.crawler.Handler(resp)
+	if elapsed := time.Since(start); w.crawler.SlowHandlerThreshold > 0 && elapsed > w.crawler.SlowHandlerThreshold {
+		w.crawler.SlowHandler(w.crawler, resp.URL, elapsed)
+	}
+}
+
+// Find links using StreamingLinkFinder or LinkFinder, returning the number of links found and the links that passed CheckURL.
+// Links found by StreamingLinkFinder are added to the crawler as soon as they pass CheckURL.
+// A panic is converted into an error so a broken page can't kill the worker.
+func (w *worker) findLinks(resp *Response) (found int, followed []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			// A StreamingLinkFinder's links are queued as they are found, so keep counting the ones it found
+			if w.crawler.StreamingLinkFinder == nil {
+				found, followed = 0, nil
+			}
+			err = errors.Appends(ErrLinkFinderPanic, fmt.Sprint(r))
+		}
+	}()
+
+	followed = make([]string, 0)
+	if w.crawler.StreamingLinkFinder != nil {
+		w.crawler.StreamingLinkFinder(resp, func(url string) {
+			found++
+			if err := w.checkURL(url); err == nil {
+				followed = append(followed, url)
+				w.crawler.urlstate.add([]string{url}, false, w.depth+1)
+			}
+		})
+		return found, followed, nil
+	}
+
+	links := w.crawler.LinkFinder(resp)
+	for _, url := range links {
+		if err := w.checkURL(url); err == nil {
+			followed = append(followed, url)
+		}
+	}
+	return len(links), followed, nil
+}
+
+// Call CheckURL, converting a panic into an error so the URL is not followed.
+// The first panic is kept so it can be reported on the Response.
+func (w *worker) checkURL(url string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Appends(ErrCheckURLPanic, fmt.Sprint(r))
+			if w.checkPanic == nil {
+				w.checkPanic = err
+			}
+		}
 	}()
+
+	return w.crawler.CheckURL(w.crawler, url)
+}
+
+// Acquire a request slot if we are limiting concurrent requests
+func (w *worker) acquireRequest() {
+	if w.crawler.requests != nil {
+		w.crawler.requests <- true
+	}
 }
 
-func (w *worker) sendResults(newurls []string, err error) {
+// Release the request slot acquired before the HTTP request
+func (w *worker) releaseRequest() {
+	if w.crawler.requests != nil {
+		<-w.crawler.requests
+	}
+}
+
+func (w *worker) sendResults(resp *Response, newurls []string) {
 	result := result{
-		err:     err,
-		url:     w.url,
-		newurls: newurls,
-		owner:   w,
+		err:        resp.Err,
+		url:        w.url,
+		newurls:    newurls,
+		owner:      w,
+		resp:       resp,
+		rejected:   resp.rejected,
+		disallowed: resp.disallowed,
+		cancelled:  resp.cancelled,
 	}
 
+	w.crawler.streamResult(result)
 	w.results <- result
 }
 
+// Check if an error reading a body was caused by invalid or truncated compressed content
+func isDecompressionErr(err error, uncompressed bool) bool {
+	if _, ok := err.(flate.CorruptInputError); ok {
+		return true
+	}
+	if err == gzip.ErrHeader || err == gzip.ErrChecksum {
+		return true
+	}
+	return uncompressed && err == io.ErrUnexpectedEOF
+}
+
+// Check if an error was caused by a timeout, either of the client or of a deadline set with SetURLTimeout
+func isTimeoutErr(err error) bool {
+	if err == context.DeadlineExceeded {
+		return true
+	}
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// Do an HTTP request, applying any timeout set for the URL with SetURLTimeout
+func (w *worker) do(req *http.Request) (*http.Response, error) {
+	client := w.clientFor(req.URL.Scheme)
+
+	timeout, ok := w.crawler.urlstate.timeout(w.url)
+	if !ok {
+		return client.Do(req)
+	}
+
+	// Replace the client's timeout with a deadline on the request. The deadline also covers reading the body,
+	// so it is cancelled once the worker has finished with this URL.
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	if w.cancel != nil {
+		// Release the deadline of a previous attempt at this URL
+		w.cancel()
+	}
+	w.cancel = cancel
+	override := *client
+	override.Timeout = 0
+	return override.Do(req.WithContext(ctx))
+}
+
+// Set the crawler's extra headers and User-Agent on a request
+func (w *worker) setHeaders(req *http.Request) {
+	for name, values := range w.crawler.Header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	if w.crawler.UserAgent != "" {
+		req.Header.Set("User-Agent", w.crawler.UserAgent)
+	}
+}
+
+// Get the client to use for a URL scheme
+func (w *worker) clientFor(scheme string) *http.Client {
+	factory, ok := w.crawler.SchemeClients[scheme]
+	if !ok {
+		return w.client
+	}
+	if w.clients == nil {
+		w.clients = make(map[string]*http.Client)
+	}
+	if _, ok := w.clients[scheme]; !ok {
+		w.clients[scheme] = w.crawler.newClient(factory)
+	}
+	return w.clients[scheme]
+}
+
+// Get a new client from a client factory, guarding it against redirects from a URL to itself.
+// The client is copied so that the guard doesn't modify a client that may be shared.
+func (c *Crawler) newClient(factory func() *http.Client) *http.Client {
+	client := *factory()
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if sameURL(req.URL, via[len(via)-1].URL) {
+			return ErrSelfRedirect
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		// Same as the net/http default policy
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &client
+}
+
+// Check if two URLs are the same, ignoring any #fragment
+func sameURL(a, b *url.URL) bool {
+	x, y := *a, *b
+	x.Fragment, y.Fragment = "", ""
+	return x.String() == y.String()
+}
+
 // ReadCloser is a dummy type that makes bytes.Reader compatible with ReadCloser so we can use it to replace Body
 type readCloser struct {
 	*bytes.Reader
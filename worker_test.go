@@ -0,0 +1,270 @@
+package crawlbot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSniffContentType(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n" + `<a href="/a">a</a>`
+	rec := newRecorder()
+	c := &Crawler{
+		URLs:             []string{"http://example.com/"},
+		NumWorkers:       1,
+		SniffContentType: true,
+		Handler:          rec.handle,
+		Client:           NewMockClient(map[string]MockResponse{"http://example.com/": {Body: png}}),
+	}
+	crawl(t, c)
+
+	resp := rec.get("http://example.com/")
+	if resp.DetectedContentType != "image/png" {
+		t.Errorf("Expected image/png to be detected, got %q", resp.DetectedContentType)
+	}
+	if resp.Doc != nil || resp.LinksFound != 0 {
+		t.Errorf("Expected a binary body labelled as HTML not to be parsed, found %d links", resp.LinksFound)
+	}
+	if state := c.State("http://example.com/a"); state != StateNotFound {
+		t.Errorf("Expected no links to be followed from a binary body, got %v", state)
+	}
+}
+
+func TestSelfRedirect(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/": {StatusCode: http.StatusMovedPermanently, Header: http.Header{"Location": {"http://example.com/#top"}}},
+	}
+	transport := newTestTransport(pages)
+	rec := newRecorder()
+	c := &Crawler{
+		URLs:        []string{"http://example.com/"},
+		NumWorkers:  1,
+		Handler:     rec.handle,
+		Client:      transport.client,
+		RetryPolicy: func(errKind ErrKind, attempt int) (bool, time.Duration) { return attempt < 5, 0 },
+	}
+	crawl(t, c)
+
+	if resp := rec.get("http://example.com/"); resp == nil || !isErr(resp.Err, ErrSelfRedirect) {
+		t.Errorf("Expected ErrSelfRedirect, got %v", resp)
+	}
+	if n := transport.count("http://example.com/"); n != 1 {
+		t.Errorf("Expected a self-redirect to be fetched once and not retried, got %d requests", n)
+	}
+}
+
+func TestTransformBody(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/":  {Body: `render("<a href=\"/a\">a</a>");`},
+		"http://example.com/a": {},
+	}
+	rec := newRecorder()
+	c := &Crawler{
+		URLs:       []string{"http://example.com/"},
+		NumWorkers: 1,
+		Handler:    rec.handle,
+		Client:     NewMockClient(pages),
+		TransformBody: func(resp *Response, raw []byte) []byte {
+			body := strings.TrimSuffix(strings.TrimPrefix(string(raw), `render("`), `");`)
+			return []byte(strings.ReplaceAll(body, `\"`, `"`))
+		},
+	}
+	crawl(t, c)
+
+	if rec.get("http://example.com/a") == nil {
+		t.Error("Expected links in the transformed body to be followed")
+	}
+	body := make([]byte, 100)
+	n, _ := rec.get("http://example.com/").Body.Read(body)
+	if string(body[:n]) != `<a href="/a">a</a>` {
+		t.Errorf("Expected the Handler to be passed the transformed body, got %q", body[:n])
+	}
+}
+
+func TestInvalidGzip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte("<html>not actually gzip</html>"))
+	}))
+	defer server.Close()
+
+	rec := newRecorder()
+	c := &Crawler{URLs: []string{server.URL + "/"}, NumWorkers: 1, Handler: rec.handle, Client: func() *http.Client { return &http.Client{} }}
+	crawl(t, c)
+
+	if resp := rec.get(server.URL + "/"); resp == nil || !isErr(resp.Err, ErrDecompression) {
+		t.Errorf("Expected ErrDecompression to be passed to the Handler, got %v", resp)
+	}
+}
+
+func TestBodyReadTimeout(t *testing.T) {
+	release := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte("<html><body>partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	rec := newRecorder()
+	c := &Crawler{
+		URLs:       []string{server.URL + "/"},
+		NumWorkers: 1,
+		Handler:    rec.handle,
+		Client:     func() *http.Client { return &http.Client{Timeout: 100 * time.Millisecond} },
+	}
+	crawl(t, c)
+
+	resp := rec.get(server.URL + "/")
+	if resp == nil || !isErr(resp.Err, ErrBodyReadTimeout) {
+		t.Fatalf("Expected ErrBodyReadTimeout, got %v", resp)
+	}
+	body := make([]byte, 100)
+	n, _ := resp.Body.Read(body)
+	if string(body[:n]) != "<html><body>partial" {
+		t.Errorf("Expected the partial body to be passed along, got %q", body[:n])
+	}
+}
+
+func TestRecycleClientAfter(t *testing.T) {
+	pages := map[string]MockResponse{"http://example.com/": {Body: `<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a><a href="/4">4</a>`}}
+	for _, page := range []string{"1", "2", "3", "4"} {
+		pages["http://example.com/"+page] = MockResponse{}
+	}
+	var mux sync.Mutex
+	clients := 0
+	mock := NewMockClient(pages)
+	c := &Crawler{
+		URLs:               []string{"http://example.com/"},
+		NumWorkers:         1,
+		RecycleClientAfter: 2,
+		Handler:            func(resp *Response) {},
+		Client: func() *http.Client {
+			mux.Lock()
+			defer mux.Unlock()
+			clients++
+			return mock()
+		},
+	}
+	crawl(t, c)
+
+	if clients != 3 {
+		t.Errorf("Expected 5 requests to use 3 clients, got %d", clients)
+	}
+}
+
+func TestSchemeClients(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/":   {Body: `<a href="https://example.com/s">s</a>`},
+		"https://example.com/s": {},
+	}
+	plain := newTestTransport(pages)
+	secure := newTestTransport(pages)
+	c := &Crawler{
+		URLs:          []string{"http://example.com/"},
+		NumWorkers:    1,
+		Handler:       func(resp *Response) {},
+		Client:        plain.client,
+		SchemeClients: map[string]func() *http.Client{"https": secure.client},
+	}
+	crawl(t, c)
+
+	if plain.count("http://example.com/") != 1 || plain.count("https://example.com/s") != 0 {
+		t.Error("Expected the default client to be used only for http URLs")
+	}
+	if secure.count("https://example.com/s") != 1 || secure.count("http://example.com/") != 0 {
+		t.Error("Expected the https client to be used only for https URLs")
+	}
+}
+
+func TestShouldParseHTML(t *testing.T) {
+	pages := map[string]MockResponse{
+		"http://example.com/":  {Header: http.Header{"Content-Type": {"text/plain"}}, Body: `<a href="/a">a</a>`},
+		"http://example.com/a": {},
+	}
+	for _, parse := range []bool{false, true} {
+		rec := newRecorder()
+		c := &Crawler{
+			URLs:        []string{"http://example.com/"},
+			NumWorkers:  1,
+			Handler:     rec.handle,
+			Client:      NewMockClient(pages),
+			CheckHeader: func(crawler *Crawler, url string, status int, header http.Header) error { return nil },
+		}
+		if parse {
+			c.ShouldParseHTML = func(resp *Response) bool { return true }
+		}
+		crawl(t, c)
+
+		if resp := rec.get("http://example.com/"); (resp.Doc != nil) != parse {
+			t.Errorf("ShouldParseHTML returning %v: expected Doc to be set %v", parse, parse)
+		}
+		if followed := rec.get("http://example.com/a") != nil; followed != parse {
+			t.Errorf("ShouldParseHTML returning %v: expected links to be followed %v", parse, parse)
+		}
+	}
+}
+
+func TestPerWorkerDelay(t *testing.T) {
+	pages := map[string]MockResponse{"http://example.com/": {Body: `<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a>`}}
+	for _, page := range []string{"1", "2", "3"} {
+		pages["http://example.com/"+page] = MockResponse{}
+	}
+	transport := newTestTransport(pages)
+	c := &Crawler{URLs: []string{"http://example.com/"}, NumWorkers: 1, PerWorkerDelay: 30 * time.Millisecond, Handler: func(resp *Response) {}, Client: transport.client}
+	crawl(t, c)
+
+	if len(transport.times) != 4 {
+		t.Fatalf("Expected 4 requests, got %d", len(transport.times))
+	}
+	for i := 1; i < len(transport.times); i++ {
+		if gap := transport.times[i].Sub(transport.times[i-1]); gap < 25*time.Millisecond {
+			t.Errorf("Expected requests to be at least PerWorkerDelay apart, request %d followed after %s", i, gap)
+		}
+	}
+}
+
+// A RoundTripper that counts calls to CloseIdleConnections
+type closingTransport struct {
+	http.RoundTripper
+	mux    sync.Mutex
+	closed int
+}
+
+func (t *closingTransport) CloseIdleConnections() {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.closed++
+}
+
+func TestRecycleClosesIdleConnections(t *testing.T) {
+	pages := map[string]MockResponse{"http://example.com/": {Body: `<a href="https://example.com/1">1</a><a href="/2">2</a>`}}
+	pages["https://example.com/1"] = MockResponse{}
+	pages["http://example.com/2"] = MockResponse{}
+	mock := NewMockClient(pages)
+	plain := &closingTransport{RoundTripper: mock().Transport}
+	secure := &closingTransport{RoundTripper: mock().Transport}
+	c := &Crawler{
+		URLs:               []string{"http://example.com/"},
+		NumWorkers:         1,
+		RecycleClientAfter: 2,
+		Handler:            func(resp *Response) {},
+		Client:             func() *http.Client { return &http.Client{Transport: plain} },
+		SchemeClients:      map[string]func() *http.Client{"https": func() *http.Client { return &http.Client{Transport: secure} }},
+	}
+	crawl(t, c)
+
+	if plain.closed != 1 || secure.closed != 1 {
+		t.Errorf("Expected the recycled clients' idle connections to be closed once, got %d and %d", plain.closed, secure.closed)
+	}
+}